@@ -10,6 +10,7 @@ import (
 
 	"github.com/goburrow/melon/core"
 	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/logging"
 )
 
 // Principal represents any entity.
@@ -78,6 +79,11 @@ func NewFilter(authenticator Authenticator, options ...Option) filter.Filter {
 	return f
 }
 
+// Priority returns filter.PriorityAuth.
+func (f *authFilter) Priority() int {
+	return filter.PriorityAuth
+}
+
 func (f *authFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	p, err := f.authenticator.Authenticate(r)
 	if err != nil {
@@ -90,6 +96,7 @@ func (f *authFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		f.unauthorizedHandler.ServeHTTP(w, r)
 		return
 	}
+	logging.SetPrincipal(r, p.Name())
 	ctx := newContext(r.Context(), p)
 	filter.Continue(w, r.WithContext(ctx))
 }
@@ -126,6 +133,12 @@ func fromContext(ctx context.Context) Principal {
 	return nil
 }
 
+// FromRequest returns Principal assigned to the request or nil if the request
+// has not been authenticated.
+func FromRequest(r *http.Request) Principal {
+	return fromContext(r.Context())
+}
+
 // Must returns Principal assigned to the request.
 // If no principal found in the request context, it will panic.
 // This panic should not happen if Filter is added to the server correctly.
@@ -2,9 +2,11 @@ package core
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
 	"runtime"
+	"sync"
 
 	"github.com/goburrow/melon/health"
 )
@@ -47,8 +49,9 @@ type AdminEnvironment struct {
 	Router       Router
 	HealthChecks health.Registry
 
-	handlers []AdminHandler
-	tasks    []Task
+	handlers    []AdminHandler
+	tasks       []Task
+	healthCheck *healthCheckHandler
 }
 
 // NewAdminEnvironment allocates and returns a new AdminEnvironment.
@@ -56,8 +59,9 @@ func NewAdminEnvironment() *AdminEnvironment {
 	env := &AdminEnvironment{
 		HealthChecks: health.NewRegistry(),
 	}
+	env.healthCheck = &healthCheckHandler{registry: env.HealthChecks}
 	// Default handlers
-	env.AddHandler(&pingHandler{}, &runtimeHandler{}, &healthCheckHandler{env.HealthChecks})
+	env.AddHandler(&pingHandler{}, &runtimeHandler{}, env.healthCheck)
 	// Default tasks
 	env.AddTask(&gcTask{})
 	return env
@@ -73,8 +77,10 @@ func (env *AdminEnvironment) AddHandler(handler ...AdminHandler) {
 	env.handlers = append(env.handlers, handler...)
 }
 
-// start registers all required HTTP handlers
-func (env *AdminEnvironment) start() {
+// start registers all required HTTP handlers. Health checks which become
+// unhealthy are reported to reporter.
+func (env *AdminEnvironment) start(reporter ErrorReporter) {
+	env.healthCheck.reporter = reporter
 	env.Router.Handle("GET", "/", &adminIndex{
 		handlers:    env.handlers,
 		contextPath: env.Router.PathPrefix(),
@@ -142,6 +148,11 @@ func (handler *adminIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // healthCheckHandler is the http handler for /healthcheck page
 type healthCheckHandler struct {
 	registry health.Registry
+	reporter ErrorReporter
+
+	mu sync.Mutex
+	// unhealthy contains names of checks which were unhealthy in last run.
+	unhealthy map[string]bool
 }
 
 func (handler *healthCheckHandler) Name() string {
@@ -161,6 +172,7 @@ func (handler *healthCheckHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
+	handler.reportUnhealthy(results)
 	if !isAllHealthy(results) {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
@@ -194,6 +206,42 @@ func isAllHealthy(results map[string]health.Result) bool {
 	return true
 }
 
+// reportUnhealthy sends health checks which have become unhealthy since
+// the last run to the ErrorReporter. Checks which stay unhealthy are not
+// reported again until they recover.
+func (handler *healthCheckHandler) reportUnhealthy(results map[string]health.Result) {
+	var reports []*ErrorReport
+	handler.mu.Lock()
+	for name, result := range results {
+		if result.Healthy() {
+			delete(handler.unhealthy, name)
+			continue
+		}
+		if handler.unhealthy[name] {
+			continue
+		}
+		if handler.unhealthy == nil {
+			handler.unhealthy = make(map[string]bool)
+		}
+		handler.unhealthy[name] = true
+		err := result.Cause()
+		if err == nil {
+			err = errors.New(result.Message())
+		}
+		reports = append(reports, &ErrorReport{
+			Source: "health",
+			Err:    fmt.Errorf("health check %s: %v", name, err),
+		})
+	}
+	handler.mu.Unlock()
+	if handler.reporter == nil {
+		return
+	}
+	for _, report := range reports {
+		handler.reporter.ReportError(report)
+	}
+}
+
 // pingHandler handles ping request to admin /ping
 type pingHandler struct {
 }
@@ -1,5 +1,10 @@
 package core
 
+import (
+	"fmt"
+	"runtime/debug"
+)
+
 // Managed is an interface for objects which need to be started and stopped as
 // the application is started or stopped.
 type Managed interface {
@@ -28,32 +33,45 @@ func (env *LifecycleEnvironment) Manage(obj Managed) {
 }
 
 // start indicates the application is going to start.
-func (env *LifecycleEnvironment) start() {
+func (env *LifecycleEnvironment) start(errors *ErrorEnvironment) {
 	// Starting managed objects in order.
 	for _, m := range env.managedObjects {
 		// Panic from a managed object will stop the application.
 		if err := m.Start(); err != nil {
 			GetLogger("melon").Errorf("error starting managed object %#v: %v", m, err)
+			errors.ReportError(&ErrorReport{
+				Source: "lifecycle",
+				Err:    fmt.Errorf("start %T: %v", m, err),
+			})
 		}
 	}
 }
 
 // stop indicates the application has stopped.
-func (env *LifecycleEnvironment) stop() {
+func (env *LifecycleEnvironment) stop(errors *ErrorEnvironment) {
 	// Stopping managed objects in reversed order.
 	for i := len(env.managedObjects) - 1; i >= 0; i-- {
 		// Panic from a managed object will NOT stop the application immediately.
-		stopManagedObject(env.managedObjects[i])
+		stopManagedObject(env.managedObjects[i], errors)
 	}
 }
 
-func stopManagedObject(m Managed) {
+func stopManagedObject(m Managed, errors *ErrorEnvironment) {
 	var err error
 	defer func() {
 		if err != nil {
 			GetLogger("melon").Errorf("error stopping managed object %#v: %v", m, err)
+			errors.ReportError(&ErrorReport{
+				Source: "lifecycle",
+				Err:    fmt.Errorf("stop %T: %v", m, err),
+			})
 		} else if r := recover(); r != nil {
 			GetLogger("melon").Errorf("panic stopping managed object %#v: %v", m, r)
+			errors.ReportError(&ErrorReport{
+				Source: "lifecycle",
+				Err:    fmt.Errorf("stop %T: panic: %v", m, r),
+				Stack:  debug.Stack(),
+			})
 		}
 	}()
 	err = m.Stop()
@@ -71,6 +89,8 @@ type Environment struct {
 	Admin *AdminEnvironment
 	// Validator validates communication data structures.
 	Validator Validator
+	// Errors sends errors and panics to registered ErrorReporters.
+	Errors *ErrorEnvironment
 }
 
 // NewEnvironment allocates and returns new Environment
@@ -79,19 +99,20 @@ func NewEnvironment() *Environment {
 		Server:    NewServerEnvironment(),
 		Lifecycle: NewLifecycleEnvironment(),
 		Admin:     NewAdminEnvironment(),
+		Errors:    NewErrorEnvironment(),
 	}
 }
 
 // SetStarting calls onStarting of all registered event listeners.
 func (env *Environment) Start() error {
 	env.Server.start()
-	env.Admin.start()
-	env.Lifecycle.start()
+	env.Admin.start(env.Errors)
+	env.Lifecycle.start(env.Errors)
 	return nil
 }
 
 // SetStopped calls onStopped of all registered event listeners in descending order.
 func (env *Environment) Stop() error {
-	env.Lifecycle.stop()
+	env.Lifecycle.stop(env.Errors)
 	return nil
 }
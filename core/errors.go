@@ -0,0 +1,58 @@
+package core
+
+import (
+	"net/http"
+	"time"
+)
+
+// ErrorReport is an error reported to ErrorReporters.
+type ErrorReport struct {
+	Time time.Time
+	// Source is the component which reports the error, e.g. "server",
+	// "views", "lifecycle" or "health".
+	Source string
+	Err    error
+	// Stack is the stack trace when the error is a panic.
+	Stack []byte
+	// Request is the HTTP request being served or nil. It must not be
+	// retained after ReportError returns.
+	Request   *http.Request
+	RequestID string
+}
+
+// ErrorReporter receives errors and panics, e.g. to forward them to an
+// error tracker. ReportError is called concurrently and should not block.
+type ErrorReporter interface {
+	ReportError(report *ErrorReport)
+}
+
+// ErrorEnvironment is an environment context to report errors. It also
+// implements ErrorReporter by sending the report to all registered reporters.
+type ErrorEnvironment struct {
+	reporters []ErrorReporter
+}
+
+// NewErrorEnvironment allocates and returns a new ErrorEnvironment.
+func NewErrorEnvironment() *ErrorEnvironment {
+	return &ErrorEnvironment{}
+}
+
+// AddReporter registers an ErrorReporter. It is not concurrent-safe and
+// should be called before the server is started.
+func (env *ErrorEnvironment) AddReporter(reporter ErrorReporter) {
+	env.reporters = append(env.reporters, reporter)
+}
+
+// ReportError sends the report to all registered ErrorReporters.
+// It does nothing when env is nil.
+func (env *ErrorEnvironment) ReportError(report *ErrorReport) {
+	if env == nil || len(env.reporters) == 0 {
+		return
+	}
+	if report.Time.IsZero() {
+		report.Time = time.Now()
+	}
+	for _, r := range env.reporters {
+		r.ReportError(report)
+	}
+}
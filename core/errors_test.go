@@ -0,0 +1,91 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goburrow/melon/health"
+)
+
+type errorManaged struct {
+}
+
+func (m *errorManaged) Start() error {
+	return errors.New("start")
+}
+
+func (m *errorManaged) Stop() error {
+	return nil
+}
+
+type testErrorReporter struct {
+	reports []*ErrorReport
+}
+
+func (r *testErrorReporter) ReportError(report *ErrorReport) {
+	r.reports = append(r.reports, report)
+}
+
+func TestReportError(t *testing.T) {
+	reporter := &testErrorReporter{}
+	env := NewErrorEnvironment()
+	env.AddReporter(reporter)
+
+	lifecycle := NewLifecycleEnvironment()
+	lifecycle.Manage(&errorManaged{})
+	lifecycle.start(env)
+	lifecycle = NewLifecycleEnvironment()
+	lifecycle.Manage(&panicManaged{})
+	lifecycle.stop(env)
+	if len(reporter.reports) != 2 {
+		t.Fatalf("unexpected reports: %+v", reporter.reports)
+	}
+	start, stop := reporter.reports[0], reporter.reports[1]
+	if start.Source != "lifecycle" || start.Time.IsZero() || start.Err.Error() != "start *core.errorManaged: start" {
+		t.Fatalf("unexpected report: %+v", start)
+	}
+	if stop.Err.Error() != "stop *core.panicManaged: panic: stop" || !strings.Contains(string(stop.Stack), "panicManaged") {
+		t.Fatalf("unexpected report: %+v", stop)
+	}
+}
+
+func TestReportUnhealthy(t *testing.T) {
+	reporter := &testErrorReporter{}
+	healthy := true
+	registry := health.NewRegistry()
+	registry.Register("db", health.CheckerFunc(func() health.Result {
+		if healthy {
+			return health.ResultHealthy("")
+		}
+		return health.ResultUnhealthy("down", nil)
+	}))
+	handler := &healthCheckHandler{registry: registry, reporter: reporter}
+
+	run := func(status int) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthcheck", nil))
+		if w.Code != status {
+			t.Fatalf("unexpected status: %d", w.Code)
+		}
+	}
+	run(http.StatusOK)
+	healthy = false
+	run(http.StatusInternalServerError)
+	run(http.StatusInternalServerError)
+	if len(reporter.reports) != 1 {
+		t.Fatalf("unexpected reports: %+v", reporter.reports)
+	}
+	if reporter.reports[0].Source != "health" || reporter.reports[0].Err.Error() != "health check db: down" {
+		t.Fatalf("unexpected report: %+v", reporter.reports[0])
+	}
+	healthy = true
+	run(http.StatusOK)
+	healthy = false
+	run(http.StatusInternalServerError)
+	if len(reporter.reports) != 2 {
+		t.Fatalf("unexpected reports: %+v", reporter.reports)
+	}
+}
@@ -18,7 +18,37 @@ type Router interface {
 	// PathPrefix returns prefix path of this handler.
 	PathPrefix() string
 	// Endpoints returns registered HTTP endpoints.
-	Endpoints() []string
+	Endpoints() []Endpoint
+	// Group returns a Router which registers handlers under the given path
+	// prefix. The filters are only applied to handlers in that group.
+	Group(prefix string, filters ...http.Handler) Router
+	// Filters returns description of filters in execution order.
+	Filters() []string
+}
+
+// Endpoint describes a registered HTTP endpoint.
+type Endpoint struct {
+	Method string
+	// Path is the full path pattern including path prefix of the router.
+	Path string
+	// Handler is type of the HTTP handler.
+	Handler string
+
+	Name     string
+	Produces []string
+	Consumes []string
+	Tags     []string
+}
+
+// String returns method, path and handler type of the endpoint.
+func (e *Endpoint) String() string {
+	return fmt.Sprintf("%-7s %s (%s)", e.Method, e.Path, e.Handler)
+}
+
+// EndpointDescriber is implemented by HTTP handlers which provide additional
+// information of their endpoints.
+type EndpointDescriber interface {
+	DescribeEndpoint(*Endpoint)
 }
 
 // ServerFactory builds Server with given configuration and environment.
@@ -32,8 +62,12 @@ type ServerEnvironment struct {
 	// The default implementation is DefaultServerHandler.
 	Router Router
 
+	name             string
 	components       []interface{}
 	resourceHandlers []ResourceHandler
+	// contexts are named application contexts, each has its own router
+	// and resources.
+	contexts []*ServerEnvironment
 }
 
 // NewServerEnvironment creates a new ServerEnvironment.
@@ -41,6 +75,37 @@ func NewServerEnvironment() *ServerEnvironment {
 	return &ServerEnvironment{}
 }
 
+// Name returns name of the application context. It is empty for the default
+// application.
+func (env *ServerEnvironment) Name() string {
+	return env.name
+}
+
+// AddContext creates a new named application context and adds it into this
+// environment. It is usually called by ServerFactory which also sets Router
+// for the returned context. AddContext is not concurrent-safe.
+func (env *ServerEnvironment) AddContext(name string) *ServerEnvironment {
+	ctx := NewServerEnvironment()
+	ctx.name = name
+	env.contexts = append(env.contexts, ctx)
+	return ctx
+}
+
+// Context returns the application context with given name or nil if not found.
+func (env *ServerEnvironment) Context(name string) *ServerEnvironment {
+	for _, ctx := range env.contexts {
+		if ctx.name == name {
+			return ctx
+		}
+	}
+	return nil
+}
+
+// Contexts returns all named application contexts.
+func (env *ServerEnvironment) Contexts() []*ServerEnvironment {
+	return env.contexts
+}
+
 // Register registers component to the environment. These components will be
 // handled by all handlers added by AddResourceHandler.
 func (env *ServerEnvironment) Register(component ...interface{}) {
@@ -59,6 +124,10 @@ func (env *ServerEnvironment) start() {
 	}
 	env.logResources()
 	env.logEndpoints()
+	env.logFilters()
+	for _, ctx := range env.contexts {
+		ctx.start()
+	}
 }
 
 func (env *ServerEnvironment) handle(component interface{}) {
@@ -76,13 +145,29 @@ func (env *ServerEnvironment) logResources() {
 		}
 		fmt.Fprintf(&buf, "%T", component)
 	}
-	GetLogger("melon").Debugf("resources = [%v]", buf.String())
+	GetLogger("melon").Debugf("resources%s = [%v]", env.logSuffix(), buf.String())
 }
 
 func (env *ServerEnvironment) logEndpoints() {
 	var buf bytes.Buffer
 	for _, e := range env.Router.Endpoints() {
-		fmt.Fprintf(&buf, "    %s\n", e)
+		fmt.Fprintf(&buf, "    %s\n", e.String())
+	}
+	GetLogger("melon").Infof("endpoints%s =\n\n%s", env.logSuffix(), buf.String())
+}
+
+func (env *ServerEnvironment) logFilters() {
+	var buf bytes.Buffer
+	for _, f := range env.Router.Filters() {
+		fmt.Fprintf(&buf, "    %s\n", f)
+	}
+	GetLogger("melon").Infof("filters%s =\n\n%s", env.logSuffix(), buf.String())
+}
+
+// logSuffix returns context name for logging.
+func (env *ServerEnvironment) logSuffix() string {
+	if env.name == "" {
+		return ""
 	}
-	GetLogger("melon").Infof("endpoints =\n\n%s", buf.String())
+	return " (" + env.name + ")"
 }
@@ -44,6 +44,12 @@ func NewFilter(options ...Option) filter.Filter {
 	return f
 }
 
+// Priority returns filter.PriorityPreAuth as preflight requests do not
+// include credentials.
+func (f *corsFilter) Priority() int {
+	return filter.PriorityPreAuth
+}
+
 // ServeHTTP adds additional headers for CORS.
 func (f *corsFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	origin := r.Header.Get("Origin")
@@ -31,10 +31,15 @@ func NewBundle() core.Bundle {
 func (b *bundle) Initialize(bootstrap *core.Bootstrap) {
 }
 
-// Run registers /debug/vars and /debug/pprof/.
+// Run registers /debug/vars, /debug/pprof/ and /debug/errors, which shows
+// the last errors reported to env.Errors.
 func (b *bundle) Run(conf interface{}, env *core.Environment) error {
 	env.Admin.AddHandler(&expvarHandler{})
 
+	errorLog := NewErrorLog(defaultErrorLogSize)
+	env.Errors.AddReporter(errorLog)
+	env.Admin.AddHandler(errorLog)
+
 	pprofIndexHandler := &pprofHandler{}
 	env.Admin.AddHandler(pprofIndexHandler)
 	env.Admin.Router.Handle("*", pprofPath+"*", pprofIndexHandler)
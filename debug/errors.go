@@ -0,0 +1,112 @@
+package debug
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/goburrow/melon/core"
+)
+
+const (
+	errorsPath = "/debug/errors"
+
+	defaultErrorLogSize = 100
+)
+
+// errorRecord is a copy of core.ErrorReport without the request.
+type errorRecord struct {
+	time      time.Time
+	source    string
+	message   string
+	stack     []byte
+	method    string
+	uri       string
+	requestID string
+}
+
+// ErrorLog is a core.ErrorReporter which keeps the last reported errors in
+// memory. It is also an admin handler showing these errors.
+type ErrorLog struct {
+	mu      sync.Mutex
+	records []errorRecord
+	// next is the position of the next record in records.
+	next  int
+	total uint64
+}
+
+// NewErrorLog allocates and returns a new ErrorLog keeping size errors.
+func NewErrorLog(size int) *ErrorLog {
+	if size <= 0 {
+		size = defaultErrorLogSize
+	}
+	return &ErrorLog{
+		records: make([]errorRecord, 0, size),
+	}
+}
+
+// ReportError records the report and discards the oldest one if the log
+// is full.
+func (l *ErrorLog) ReportError(report *core.ErrorReport) {
+	record := errorRecord{
+		time:      report.Time,
+		source:    report.Source,
+		stack:     report.Stack,
+		requestID: report.RequestID,
+	}
+	if report.Err != nil {
+		record.message = report.Err.Error()
+	}
+	if report.Request != nil {
+		record.method = report.Request.Method
+		record.uri = report.Request.RequestURI
+	}
+	l.mu.Lock()
+	if len(l.records) < cap(l.records) {
+		l.records = append(l.records, record)
+	} else {
+		l.records[l.next] = record
+	}
+	l.next = (l.next + 1) % cap(l.records)
+	l.total++
+	l.mu.Unlock()
+}
+
+// Name returns name of the admin handler.
+func (l *ErrorLog) Name() string {
+	return "Errors"
+}
+
+// Path returns path of the admin handler.
+func (l *ErrorLog) Path() string {
+	return errorsPath
+}
+
+// ServeHTTP lists recorded errors, the latest first.
+func (l *ErrorLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "must-revalidate,no-cache,no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	l.mu.Lock()
+	records := make([]errorRecord, 0, len(l.records))
+	for i := 1; i <= len(l.records); i++ {
+		records = append(records, l.records[(l.next-i+len(l.records))%len(l.records)])
+	}
+	total := l.total
+	l.mu.Unlock()
+
+	fmt.Fprintf(w, "Total errors: %d\n", total)
+	for _, e := range records {
+		fmt.Fprintf(w, "\n%s [%s] %s\n", e.time.Format(time.RFC3339), e.source, e.message)
+		if e.method != "" {
+			fmt.Fprintf(w, "Request: %s %s\n", e.method, e.uri)
+		}
+		if e.requestID != "" {
+			fmt.Fprintf(w, "Request ID: %s\n", e.requestID)
+		}
+		if len(e.stack) > 0 {
+			fmt.Fprintf(w, "%s", e.stack)
+		}
+	}
+}
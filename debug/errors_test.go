@@ -0,0 +1,48 @@
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/core"
+)
+
+func TestErrorLog(t *testing.T) {
+	l := NewErrorLog(2)
+	for i := 1; i <= 3; i++ {
+		l.ReportError(&core.ErrorReport{
+			Time:      time.Date(2017, time.January, 1, 0, 0, i, 0, time.UTC),
+			Source:    "server",
+			Err:       fmt.Errorf("error %d", i),
+			Request:   httptest.NewRequest("GET", "/path", nil),
+			RequestID: "abc",
+		})
+	}
+	l.ReportError(&core.ErrorReport{
+		Time:   time.Date(2017, time.January, 1, 0, 0, 4, 0, time.UTC),
+		Source: "health",
+		Err:    errors.New("error 4"),
+		Stack:  []byte("stack\n"),
+	})
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest("GET", errorsPath, nil))
+	expected := `Total errors: 4
+
+2017-01-01T00:00:04Z [health] error 4
+stack
+
+2017-01-01T00:00:03Z [server] error 3
+Request: GET /path
+Request ID: abc
+`
+	if expected != w.Body.String() {
+		t.Fatalf("unexpected response:\n%s\nwant:\n%s", w.Body.String(), expected)
+	}
+	if strings.Contains(w.Body.String(), "error 2") {
+		t.Fatalf("oldest errors must be discarded: %s", w.Body.String())
+	}
+}
@@ -57,6 +57,24 @@ func getThreshold(threshold string) (gol.Level, error) {
 	return level, nil
 }
 
+// ParseThreshold returns logging level of threshold or gol.All if it is empty.
+func ParseThreshold(threshold string) (gol.Level, error) {
+	return getThreshold(threshold)
+}
+
+// ParseFacility returns syslog facility of the given name, e.g. LOCAL0, or
+// LOG_USER if it is empty.
+func ParseFacility(name string) (golsyslog.Facility, error) {
+	if name == "" {
+		return golsyslog.LOG_USER, nil
+	}
+	facility, ok := facilities[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("logging: unsupported facility %s", name)
+	}
+	return facility, nil
+}
+
 // filteredAppenderFactory is an abstract factory to create a new filteredAppender.
 type filteredAppenderFactory struct {
 	Threshold string
@@ -158,9 +176,9 @@ func (factory *SyslogAppenderFactory) Build(environment *core.Environment) (gol.
 	sa.Network = factory.Network
 	sa.Addr = factory.Addr
 	if factory.Facility != "" {
-		facility, ok := facilities[strings.ToUpper(factory.Facility)]
-		if !ok {
-			return nil, fmt.Errorf("logging: unsupported facility %s", factory.Facility)
+		facility, err := ParseFacility(factory.Facility)
+		if err != nil {
+			return nil, err
 		}
 		sa.Facility = facility
 	}
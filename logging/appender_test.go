@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/goburrow/melon/core"
+
+	golsyslog "github.com/goburrow/gol/syslog"
 )
 
 var _ AppenderFactory = (*ConsoleAppenderFactory)(nil)
@@ -121,3 +123,17 @@ func TestSyslogLogging(t *testing.T) {
 		t.Fatalf("syslog appender is not created %#v", factory)
 	}
 }
+
+func TestParseFacility(t *testing.T) {
+	facility, err := ParseFacility("")
+	if err != nil || golsyslog.LOG_USER != facility {
+		t.Fatalf("unexpected facility: %v %v", facility, err)
+	}
+	facility, err = ParseFacility("local0")
+	if err != nil || golsyslog.LOG_LOCAL0 != facility {
+		t.Fatalf("unexpected facility: %v %v", facility, err)
+	}
+	if _, err = ParseFacility("unknown"); err == nil {
+		t.Fatal("error expected")
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Package ratelimit provides a filter which limits request rate of clients
+using token buckets.
+
+The filter can be added to a router group to limit only routes in that group:
+
+	api := env.Server.Router.Group("/api", ratelimit.NewFilter(ratelimit.PerMinute(60)))
+*/
+package ratelimit
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/goburrow/melon/auth"
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/filter"
+)
+
+// Rate is the number of requests allowed in a period. Limit is also
+// the maximum burst of requests.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// PerSecond returns a Rate of n requests per second.
+func PerSecond(n int) Rate {
+	return Rate{Limit: n, Period: time.Second}
+}
+
+// PerMinute returns a Rate of n requests per minute.
+func PerMinute(n int) Rate {
+	return Rate{Limit: n, Period: time.Minute}
+}
+
+// PerHour returns a Rate of n requests per hour.
+func PerHour(n int) Rate {
+	return Rate{Limit: n, Period: time.Hour}
+}
+
+// interval returns duration in nanoseconds to add one token to the bucket.
+// It is a float so that a Limit greater than Period in nanoseconds does not
+// round it down to zero.
+func (r Rate) interval() float64 {
+	return float64(r.Period) / float64(r.Limit)
+}
+
+// KeyFunc returns the key identifying client of the request.
+// Requests with an empty key are not limited.
+type KeyFunc func(r *http.Request) string
+
+// ByIP uses remote IP address of the request as the key.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ByPrincipal uses name of the authenticated auth.Principal as the key.
+// The filter must be run after the authentication filter.
+func ByPrincipal(r *http.Request) string {
+	p := auth.FromRequest(r)
+	if p == nil {
+		return ""
+	}
+	return p.Name()
+}
+
+// ByHeader uses value of the given request header as the key.
+func ByHeader(name string) KeyFunc {
+	name = http.CanonicalHeaderKey(name)
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// rateLimitFilter responds 429 Too Many Requests when clients exceed the rate.
+type rateLimitFilter struct {
+	rate  Rate
+	key   KeyFunc
+	store Store
+}
+
+// Option is a Filter option.
+type Option func(f *rateLimitFilter)
+
+// NewFilter returns a Filter which limits requests of each client to
+// the given rate. By default, clients are identified by their IP addresses
+// and buckets are stored in memory.
+func NewFilter(rate Rate, options ...Option) filter.Filter {
+	if rate.Limit <= 0 || rate.Period <= 0 {
+		panic("melon/ratelimit: invalid rate")
+	}
+	f := &rateLimitFilter{
+		rate: rate,
+		key:  ByIP,
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	if f.store == nil {
+		f.store = NewMemoryStore()
+	}
+	return f
+}
+
+// WithKey sets the function to identify clients.
+func WithKey(key KeyFunc) Option {
+	return func(f *rateLimitFilter) {
+		f.key = key
+	}
+}
+
+// WithStore sets the store of token buckets.
+func WithStore(store Store) Option {
+	return func(f *rateLimitFilter) {
+		f.store = store
+	}
+}
+
+// Priority returns filter.PriorityPostAuth so that requests can be limited
+// by the authenticated principal. Use filter.WithPriority to limit requests
+// earlier.
+func (f *rateLimitFilter) Priority() int {
+	return filter.PriorityPostAuth
+}
+
+func (f *rateLimitFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := f.key(r)
+	if key == "" {
+		filter.Continue(w, r)
+		return
+	}
+	result, err := f.store.Take(key, f.rate)
+	if err != nil {
+		// Do not reject requests when the store is unavailable.
+		core.GetLogger("melon/ratelimit").Errorf("could not take token for %s: %v", key, err)
+		filter.Continue(w, r)
+		return
+	}
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(f.rate.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", seconds(result.Reset))
+	if !result.Allowed {
+		header.Set("Retry-After", seconds(result.RetryAfter))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return
+	}
+	filter.Continue(w, r)
+}
+
+// seconds returns d in seconds, rounded up.
+func seconds(d time.Duration) string {
+	s := int64((d + time.Second - 1) / time.Second)
+	if s < 0 {
+		s = 0
+	}
+	return strconv.FormatInt(s, 10)
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/auth"
+	"github.com/goburrow/melon/server/router"
+)
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+func TestFilter(t *testing.T) {
+	rt := router.New()
+	rt.AddFilter(NewFilter(PerMinute(2)))
+	rt.Handle("GET", "/", http.HandlerFunc(ok))
+
+	for i, remaining := range []string{"1", "0"} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if http.StatusOK != w.Code {
+			t.Fatalf("%d: unexpected status code: %v", i, w.Code)
+		}
+		if "2" != w.Header().Get("RateLimit-Limit") || remaining != w.Header().Get("RateLimit-Remaining") {
+			t.Fatalf("%d: unexpected headers: %v", i, w.Header())
+		}
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if http.StatusTooManyRequests != w.Code {
+		t.Fatalf("unexpected status code: %v", w.Code)
+	}
+	if "30" != w.Header().Get("Retry-After") || "60" != w.Header().Get("RateLimit-Reset") {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+	// Another client
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if http.StatusOK != w.Code {
+		t.Fatalf("unexpected status code: %v", w.Code)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	rt := router.New()
+	rt.Handle("GET", "/", http.HandlerFunc(ok))
+	api := rt.Group("/api", NewFilter(PerSecond(1), WithKey(ByHeader("x-api-key"))))
+	api.Handle("GET", "/", http.HandlerFunc(ok))
+
+	tests := []struct {
+		path   string
+		key    string
+		status int
+	}{
+		{"/", "", http.StatusOK},
+		{"/", "", http.StatusOK},
+		{"/api/", "", http.StatusOK},
+		{"/api/", "", http.StatusOK},
+		{"/api/", "a", http.StatusOK},
+		{"/api/", "a", http.StatusTooManyRequests},
+		{"/api/", "b", http.StatusOK},
+	}
+	for i, test := range tests {
+		r := httptest.NewRequest("GET", test.path, nil)
+		if test.key != "" {
+			r.Header.Set("X-Api-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, r)
+		if test.status != w.Code {
+			t.Fatalf("%d: unexpected status code: %v", i, w.Code)
+		}
+	}
+}
+
+type stubAuthenticator struct{}
+
+func (stubAuthenticator) Authenticate(r *http.Request) (auth.Principal, error) {
+	return auth.NewPrincipal(r.URL.Query().Get("user")), nil
+}
+
+func TestByPrincipal(t *testing.T) {
+	rt := router.New()
+	rt.AddFilter(NewFilter(PerHour(1), WithKey(ByPrincipal)))
+	rt.AddFilter(auth.NewFilter(stubAuthenticator{}))
+	rt.Handle("GET", "/", http.HandlerFunc(ok))
+
+	for i, test := range []struct {
+		user   string
+		status int
+	}{
+		{"a", http.StatusOK},
+		{"b", http.StatusOK},
+		{"a", http.StatusTooManyRequests},
+	} {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest("GET", "/?user="+test.user, nil))
+		if test.status != w.Code {
+			t.Fatalf("%d: unexpected status code: %v", i, w.Code)
+		}
+	}
+	if "3600" != seconds(time.Hour) {
+		t.Fatalf("unexpected seconds: %v", seconds(time.Hour))
+	}
+}
@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Result is the state of a token bucket after taking a token.
+type Result struct {
+	// Allowed is true when a token has been taken from the bucket.
+	Allowed bool
+	// Remaining is the number of tokens left in the bucket.
+	Remaining int
+	// Reset is the time until the bucket is full.
+	Reset time.Duration
+	// RetryAfter is the time until a token is available when not allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets of clients. It must be safe for concurrent use.
+type Store interface {
+	// Take takes a token from the bucket of the given key, which is refilled
+	// according to rate.
+	Take(key string, rate Rate) (Result, error)
+}
+
+// sweepInterval is how often full buckets are removed from memory store.
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is the time the bucket becomes full again.
+	full time.Time
+}
+
+// bucketKey includes the rate so filters with different rates sharing a store
+// do not use the same buckets.
+type bucketKey struct {
+	key  string
+	rate Rate
+}
+
+// memoryStore keeps buckets in memory.
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[bucketKey]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+// NewMemoryStore returns a Store which keeps buckets in memory so it only
+// limits requests to the current process.
+func NewMemoryStore() Store {
+	return newMemoryStore(time.Now)
+}
+
+func newMemoryStore(now func() time.Time) *memoryStore {
+	return &memoryStore{
+		buckets: make(map[bucketKey]*bucket),
+		swept:   now(),
+		now:     now,
+	}
+}
+
+func (s *memoryStore) Take(key string, rate Rate) (Result, error) {
+	now := s.now()
+	interval := rate.interval()
+	limit := float64(rate.Limit)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.swept) >= sweepInterval {
+		s.sweep(now)
+	}
+	k := bucketKey{key: key, rate: rate}
+	b, ok := s.buckets[k]
+	if ok {
+		b.tokens += float64(now.Sub(b.updated)) / interval
+		if b.tokens > limit {
+			b.tokens = limit
+		}
+	} else {
+		b = &bucket{tokens: limit}
+		s.buckets[k] = b
+	}
+	b.updated = now
+
+	var result Result
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * interval)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((limit - b.tokens) * interval)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep removes buckets which are full as they are the same as new ones.
+func (s *memoryStore) sweep(now time.Time) {
+	for k, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, k)
+		}
+	}
+	s.swept = now
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	s := newMemoryStore(func() time.Time { return now })
+	rate := PerSecond(2)
+
+	take := func(allowed bool, remaining int) {
+		result, err := s.Take("a", rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != result.Allowed || remaining != result.Remaining {
+			t.Fatalf("unexpected result: %+v", result)
+		}
+	}
+	take(true, 1)
+	take(true, 0)
+	take(false, 0)
+	result, _ := s.Take("a", rate)
+	if 500*time.Millisecond != result.RetryAfter || time.Second != result.Reset {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	now = now.Add(500 * time.Millisecond)
+	take(true, 0)
+	now = now.Add(2 * time.Second)
+	take(true, 1)
+
+	// Full buckets are removed.
+	now = now.Add(sweepInterval)
+	s.Take("b", rate)
+	if 1 != len(s.buckets) || s.buckets[bucketKey{"b", rate}] == nil {
+		t.Fatalf("unexpected buckets: %v", s.buckets)
+	}
+}
+
+func TestMemoryStoreRates(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	s := newMemoryStore(func() time.Time { return now })
+	// Filters with different rates sharing the store have their own buckets.
+	for i := 0; i < 2; i++ {
+		result, _ := s.Take("a", PerSecond(1))
+		if (i == 0) != result.Allowed {
+			t.Fatalf("unexpected result %d: %+v", i, result)
+		}
+		result, _ = s.Take("a", PerMinute(10))
+		if !result.Allowed || 9-i != result.Remaining {
+			t.Fatalf("unexpected result %d: %+v", i, result)
+		}
+	}
+	// Limit is greater than period in nanoseconds.
+	rate := Rate{Limit: 2000, Period: time.Microsecond}
+	for i := 0; i < 2000; i++ {
+		s.Take("b", rate)
+	}
+	result, _ := s.Take("b", rate)
+	if result.Allowed || 0 != result.Remaining {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	// Two tokens are added every nanosecond.
+	now = now.Add(time.Nanosecond)
+	result, _ = s.Take("b", rate)
+	if !result.Allowed || 1 != result.Remaining {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
@@ -0,0 +1,189 @@
+/*
+Package body provides filters which limit size of request bodies and
+decompress them.
+*/
+package body
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/goburrow/melon/server/filter"
+)
+
+// ErrTooLarge is returned when reading request body which exceeds the limit.
+var ErrTooLarge = errors.New("request body too large")
+
+// limitFilter limits size of request bodies.
+type limitFilter struct {
+	limit int64
+}
+
+// NewLimitFilter returns a Filter which limits request bodies to n bytes.
+// Requests declaring a larger Content-Length are responded 413 Request Entity
+// Too Large without executing the rest of the chain. Otherwise, reading
+// request body exceeding the limit returns ErrTooLarge.
+// The limit can be changed per request with SetLimit.
+func NewLimitFilter(n int64) filter.Filter {
+	return &limitFilter{
+		limit: n,
+	}
+}
+
+// Priority returns filter.PriorityRequestBody.
+func (f *limitFilter) Priority() int {
+	return filter.PriorityRequestBody
+}
+
+func (f *limitFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ContentLength > f.limit {
+		status := http.StatusRequestEntityTooLarge
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		SetLimit(r, f.limit)
+	}
+	filter.Continue(w, r)
+}
+
+// SetLimit limits request body of r to n bytes. It replaces the limit set by
+// the limit filter, if any. As the limit filter rejects requests declaring
+// larger Content-Length, raising the limit only applies to requests without
+// Content-Length, e.g. chunked requests.
+func SetLimit(r *http.Request, n int64) {
+	if lr, ok := r.Body.(*limitReader); ok {
+		lr.limit = n
+		return
+	}
+	r.Body = newLimitReader(r.Body, r.ContentLength, n)
+}
+
+// IsTooLarge reports whether err is ErrTooLarge or reading the body of r has
+// exceeded its limit. Parsers of the body may wrap ErrTooLarge or, like
+// multipart forms, fail with another error when the body is truncated at the
+// limit.
+func IsTooLarge(r *http.Request, err error) bool {
+	return err == ErrTooLarge || exceeded(r.Body)
+}
+
+// exceeded checks if any limitReader of the body has exceeded its limit.
+func exceeded(body interface{}) bool {
+	switch b := body.(type) {
+	case *limitReader:
+		return b.contentLength > b.limit || b.read > b.limit || exceeded(b.rc)
+	case *decompressReader:
+		return exceeded(b.Reader) || exceeded(b.body)
+	}
+	return false
+}
+
+// limitReader returns ErrTooLarge when reading more than limit bytes.
+type limitReader struct {
+	rc            io.ReadCloser
+	contentLength int64
+	limit         int64
+	read          int64
+}
+
+func newLimitReader(rc io.ReadCloser, contentLength, limit int64) *limitReader {
+	return &limitReader{
+		rc:            rc,
+		contentLength: contentLength,
+		limit:         limit,
+	}
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	// Fail early if the client declares a larger body.
+	if r.contentLength > r.limit || r.read > r.limit {
+		return 0, ErrTooLarge
+	}
+	// Read one more byte to detect body larger than the limit.
+	if remaining := r.limit - r.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.rc.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		n -= int(r.read - r.limit)
+		err = ErrTooLarge
+	}
+	return n, err
+}
+
+func (r *limitReader) Close() error {
+	return r.rc.Close()
+}
+
+// decompressFilter decodes compressed request bodies.
+type decompressFilter struct {
+	limit int64
+}
+
+// NewDecompressFilter returns a Filter which decompresses request bodies
+// having Content-Encoding gzip or deflate. Reading more than n decompressed
+// bytes returns ErrTooLarge. Requests with other encodings are responded
+// with 415 Unsupported Media Type.
+func NewDecompressFilter(n int64) filter.Filter {
+	return &decompressFilter{
+		limit: n,
+	}
+}
+
+// Priority returns filter.PriorityEncoding.
+func (f *decompressFilter) Priority() int {
+	return filter.PriorityEncoding
+}
+
+func (f *decompressFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || r.Body == nil || r.Body == http.NoBody {
+		filter.Continue(w, r)
+		return
+	}
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(r.Body)
+	case "deflate":
+		reader, err = zlib.NewReader(r.Body)
+	default:
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		if err == ErrTooLarge {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, "invalid "+encoding+" request body", http.StatusBadRequest)
+		}
+		return
+	}
+	r.Body = &decompressReader{
+		Reader: newLimitReader(reader, -1, f.limit),
+		body:   r.Body,
+		reader: reader,
+	}
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	filter.Continue(w, r)
+}
+
+// decompressReader closes both decompressor and original request body.
+type decompressReader struct {
+	io.Reader
+	body   io.Closer
+	reader io.Closer
+}
+
+func (r *decompressReader) Close() error {
+	r.reader.Close()
+	return r.body.Close()
+}
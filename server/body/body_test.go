@@ -0,0 +1,143 @@
+package body
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goburrow/melon/server/filter"
+)
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err == ErrTooLarge {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
+}
+
+func serve(chain *filter.Chain, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	chain.ServeHTTP(w, r)
+	return w
+}
+
+func TestLimitFilter(t *testing.T) {
+	chain := filter.NewChain()
+	chain.Add(NewLimitFilter(4), http.HandlerFunc(echo))
+
+	tests := []struct {
+		body          string
+		contentLength int64
+		status        int
+	}{
+		{"1234", 4, http.StatusOK},
+		{"12345", 5, http.StatusRequestEntityTooLarge},
+		{"1234", -1, http.StatusOK},
+		{"12345", -1, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(test.body))
+		r.ContentLength = test.contentLength
+		w := serve(chain, r)
+		if test.status != w.Code {
+			t.Fatalf("unexpected status code for %+v: %v", test, w.Code)
+		}
+	}
+	// Handler not reading request body
+	chain = filter.NewChain()
+	chain.Add(NewLimitFilter(4), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	w := serve(chain, httptest.NewRequest("POST", "/", strings.NewReader("12345")))
+	if http.StatusRequestEntityTooLarge != w.Code {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body)
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	chain := filter.NewChain()
+	chain.Add(NewLimitFilter(4), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetLimit(r, 8)
+		echo(w, r)
+	}))
+	r := httptest.NewRequest("POST", "/", strings.NewReader("12345678"))
+	r.ContentLength = -1
+	w := serve(chain, r)
+	if http.StatusOK != w.Code || "12345678" != w.Body.String() {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body)
+	}
+}
+
+func TestIsTooLarge(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("12345678"))
+	r.ContentLength = -1
+	SetLimit(r, 4)
+	if IsTooLarge(r, nil) {
+		t.Fatal("body must not be too large before reading")
+	}
+	// Simulate a parser hiding the error.
+	ioutil.ReadAll(r.Body)
+	if !IsTooLarge(r, errors.New("malformed")) {
+		t.Fatal("body must be too large")
+	}
+	if !IsTooLarge(httptest.NewRequest("POST", "/", nil), ErrTooLarge) {
+		t.Fatal("ErrTooLarge must be too large")
+	}
+}
+
+func TestDecompressFilter(t *testing.T) {
+	chain := filter.NewChain()
+	chain.Add(NewDecompressFilter(10), http.HandlerFunc(echo))
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte("gzip"))
+	gw.Close()
+	var zl bytes.Buffer
+	zw := zlib.NewWriter(&zl)
+	zw.Write([]byte("deflate"))
+	zw.Close()
+	var bomb bytes.Buffer
+	gw = gzip.NewWriter(&bomb)
+	gw.Write(make([]byte, 1000))
+	gw.Close()
+
+	tests := []struct {
+		encoding string
+		body     []byte
+		status   int
+		response string
+	}{
+		{"", []byte("plain"), http.StatusOK, "plain"},
+		{"gzip", gz.Bytes(), http.StatusOK, "gzip"},
+		{"deflate", zl.Bytes(), http.StatusOK, "deflate"},
+		{"gzip", bomb.Bytes(), http.StatusRequestEntityTooLarge, ""},
+		{"gzip", []byte("plain"), http.StatusBadRequest, ""},
+		{"br", []byte("plain"), http.StatusUnsupportedMediaType, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", bytes.NewReader(test.body))
+		if test.encoding != "" {
+			r.Header.Set("Content-Encoding", test.encoding)
+		}
+		w := serve(chain, r)
+		if test.status != w.Code {
+			t.Fatalf("unexpected status code for %s: %v", test.encoding, w.Code)
+		}
+		if test.response != "" && test.response != w.Body.String() {
+			t.Fatalf("unexpected response for %s: %s", test.encoding, w.Body)
+		}
+	}
+}
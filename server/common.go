@@ -2,47 +2,150 @@ package server
 
 import (
 	"fmt"
-	"io"
-	"os"
+	"strings"
+	"time"
 
-	"github.com/goburrow/gol/file/rotation"
 	"github.com/goburrow/melon/core"
-	"github.com/goburrow/melon/logging"
+	"github.com/goburrow/melon/server/body"
 	"github.com/goburrow/melon/server/filter"
 	"github.com/goburrow/melon/server/gzip"
-	slogging "github.com/goburrow/melon/server/logging"
 	"github.com/goburrow/melon/server/recovery"
+	"github.com/goburrow/melon/server/requestid"
 	"github.com/goburrow/melon/server/router"
+	"github.com/goburrow/melon/server/security"
+	"github.com/goburrow/melon/server/timeout"
 )
 
 // commonFactory is the shared configuration of DefaultFactory and
 // SimpleFactory.
 type commonFactory struct {
+	RequestID  RequestIDConfiguration
 	RequestLog RequestLogConfiguration
-	Gzip       GzipConfiguration
+	// AdminRequestLog is the request log of the admin router. Admin requests
+	// are recorded in RequestLog when it is not set.
+	AdminRequestLog *RequestLogConfiguration
+	SlowRequestLog  SlowRequestLogConfiguration
+	Timeout         TimeoutConfiguration
+	Recovery        RecoveryConfiguration
+	RequestBody     RequestBodyConfiguration
+	Security        SecurityConfiguration
+	Gzip            GzipConfiguration
+
+	// Request log filters are built once and shared between handlers.
+	requestLog      *builtFilter
+	adminRequestLog *builtFilter
+}
+
+// builtFilter is a filter built from the configuration, or the build error.
+type builtFilter struct {
+	filter filter.Filter
+	err    error
+}
+
+func (f *commonFactory) requestLogFilter(env *core.Environment) (filter.Filter, error) {
+	if f.requestLog == nil {
+		f.requestLog = &builtFilter{}
+		f.requestLog.filter, f.requestLog.err = f.RequestLog.Build(env)
+	}
+	return f.requestLog.filter, f.requestLog.err
+}
+
+func (f *commonFactory) adminRequestLogFilter(env *core.Environment) (filter.Filter, error) {
+	if f.AdminRequestLog == nil {
+		return f.requestLogFilter(env)
+	}
+	if f.adminRequestLog == nil {
+		f.adminRequestLog = &builtFilter{}
+		f.adminRequestLog.filter, f.adminRequestLog.err = f.AdminRequestLog.Build(env)
+	}
+	return f.adminRequestLog.filter, f.adminRequestLog.err
 }
 
 // AddFilters adds request log and panic recovery to the filter chain
-// of the given handlers.
+// of the given application handlers. Filters are ordered by their priority.
 func (f *commonFactory) AddFilters(env *core.Environment, handlers ...*router.Router) error {
+	requestLog, err := f.requestLogFilter(env)
+	if err != nil {
+		return err
+	}
+	timeoutFilter, err := f.Timeout.Build()
+	if err != nil {
+		return err
+	}
+	return f.addFilters(env, requestLog, timeoutFilter, handlers...)
+}
+
+// AddAdminFilters is similar to AddFilters but uses AdminRequestLog if set.
+// Admin requests have no timeout as some of them, e.g. profiling, take long.
+func (f *commonFactory) AddAdminFilters(env *core.Environment, handlers ...*router.Router) error {
+	requestLog, err := f.adminRequestLogFilter(env)
+	if err != nil {
+		return err
+	}
+	return f.addFilters(env, requestLog, nil, handlers...)
+}
+
+// addFilters adds default filters and the given request log and timeout
+// filters, which can be nil, to the handlers.
+func (f *commonFactory) addFilters(env *core.Environment, requestLog, timeoutFilter filter.Filter, handlers ...*router.Router) error {
+	// Request ID
+	if f.RequestID.Enabled {
+		requestIDFilter, err := f.RequestID.Build()
+		if err != nil {
+			return err
+		}
+		for _, h := range handlers {
+			h.AddFilter(requestIDFilter)
+		}
+	}
 	// Request log must be first as handler panic should be recorded.
-	requestLogFilter, err := f.RequestLog.Build(env)
+	if requestLog != nil {
+		for _, h := range handlers {
+			h.AddFilter(requestLog)
+		}
+	}
+	slowRequestLog, err := f.SlowRequestLog.Build()
 	if err != nil {
 		return err
 	}
-	if requestLogFilter != nil {
+	if slowRequestLog != nil {
 		for _, h := range handlers {
-			h.AddFilter(requestLogFilter)
+			h.AddFilter(slowRequestLog)
+		}
+	}
+	// Timeout
+	if timeoutFilter != nil {
+		for _, h := range handlers {
+			h.AddFilter(timeoutFilter)
 		}
 	}
 	// Recover
-	recoveryFilter := recovery.NewFilter()
+	recoveryFilter := f.Recovery.Build(env)
 	for _, h := range handlers {
 		h.AddFilter(recoveryFilter)
 	}
+	// Security headers
+	if f.Security.Enabled {
+		securityFilter, err := f.Security.Build()
+		if err != nil {
+			return err
+		}
+		for _, h := range handlers {
+			h.AddFilter(securityFilter)
+		}
+	}
+	// Request body
+	for _, bodyFilter := range f.RequestBody.Build() {
+		for _, h := range handlers {
+			h.AddFilter(bodyFilter)
+		}
+	}
 	// Gzip
 	if f.Gzip.Enabled {
-		gzipFilter := gzip.NewFilter()
+		gzipFilter, err := f.Gzip.Build()
+		if err != nil {
+			return err
+		}
 		for _, h := range handlers {
 			h.AddFilter(gzipFilter)
 		}
@@ -50,83 +153,197 @@ func (f *commonFactory) AddFilters(env *core.Environment, handlers ...*router.Ro
 	return nil
 }
 
-// RequestLogConfiguration is the configuration for the server request log.
-// It utilized the configuration of logging appenders.
-type RequestLogConfiguration struct {
-	Appenders []logging.AppenderConfiguration
+// RequestIDConfiguration is the configuration for assigning an ID to each
+// request. Format is either "uuid" (default) or "ulid".
+type RequestIDConfiguration struct {
+	Enabled bool
+	Header  string
+	Format  string
+}
+
+// Build returns a request ID filter.
+func (f *RequestIDConfiguration) Build() (filter.Filter, error) {
+	var options []requestid.Option
+	if f.Header != "" {
+		options = append(options, requestid.WithHeader(f.Header))
+	}
+	switch strings.ToLower(f.Format) {
+	case "", "uuid":
+		options = append(options, requestid.WithGenerator(requestid.NewUUID))
+	case "ulid":
+		options = append(options, requestid.WithGenerator(requestid.NewULID))
+	default:
+		return nil, fmt.Errorf("server: unsupported request ID format %v", f.Format)
+	}
+	return requestid.NewFilter(options...), nil
 }
 
-// Build returns nil Filter if no appenders are set.
-func (f *RequestLogConfiguration) Build(_ *core.Environment) (filter.Filter, error) {
-	var writers []io.Writer
+// TimeoutConfiguration is the configuration for request timeout.
+// Timeout is a duration string such as "30s". DeadlineHeader is the request
+// header which clients can use to provide a shorter timeout.
+// It is not applied to admin requests.
+type TimeoutConfiguration struct {
+	Timeout        string
+	DeadlineHeader string
+}
 
-	for _, appender := range f.Appenders {
-		switch appenderFactory := appender.Value().(type) {
-		case *logging.ConsoleAppenderFactory:
-			w, err := buildConsoleWriter(appenderFactory)
-			if err != nil {
-				return nil, err
-			}
-			writers = append(writers, w)
-		case *logging.FileAppenderFactory:
-			w, err := buildFileWriter(appenderFactory)
-			if err != nil {
-				return nil, err
-			}
-			writers = append(writers, w)
-		default:
-			return nil, fmt.Errorf("server: unsupported request log appender %#v", appender.Value())
+// Build returns nil Filter if neither timeout nor deadline header is set.
+func (f *TimeoutConfiguration) Build() (filter.Filter, error) {
+	var d time.Duration
+	if f.Timeout != "" {
+		var err error
+		d, err = time.ParseDuration(f.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("server: invalid timeout %v: %v", f.Timeout, err)
 		}
 	}
-	if len(writers) == 0 {
-		// No request log
+	if d <= 0 && f.DeadlineHeader == "" {
 		return nil, nil
 	}
-	var w io.Writer
-	if len(writers) > 1 {
-		w = io.MultiWriter(writers...)
-	} else {
-		w = writers[0]
+	var options []timeout.Option
+	if f.DeadlineHeader != "" {
+		options = append(options, timeout.WithDeadlineHeader(f.DeadlineHeader))
 	}
-	return slogging.NewFilter(w), nil
+	return timeout.NewFilter(d, options...), nil
 }
 
-func buildConsoleWriter(config *logging.ConsoleAppenderFactory) (io.Writer, error) {
-	// TODO: Mutex on os.Std{out,err}
-	switch config.Target {
-	case "", "stdout":
-		return os.Stdout, nil
-	case "stderr":
-		return os.Stderr, nil
-	default:
-		return nil, fmt.Errorf("server: unsupported appender target %v", config.Target)
+// RecoveryConfiguration is the configuration for recovering panics.
+// RepanicAbort lets http.ErrAbortHandler abort the response silently
+// instead of being logged as other panics.
+type RecoveryConfiguration struct {
+	RepanicAbort bool
+}
+
+// Build returns a Filter which recovers panics and reports them to
+// env.Errors.
+func (f *RecoveryConfiguration) Build(env *core.Environment) filter.Filter {
+	options := []recovery.Option{recovery.WithErrorReporter(env.Errors)}
+	if f.RepanicAbort {
+		options = append(options, recovery.WithRepanicAbort())
 	}
+	return recovery.NewFilter(options...)
+}
+
+// defaultMaxDecompressedSize is the decompressed size limit of request bodies
+// when it is not set in RequestBodyConfiguration.
+const defaultMaxDecompressedSize = 10 << 20
+
+// RequestBodyConfiguration is the configuration for request bodies.
+// MaxSize is the maximum number of bytes of request bodies, zero means
+// unlimited. Decompress enables decoding gzip and deflate request bodies
+// up to MaxDecompressedSize bytes (default 10MiB).
+type RequestBodyConfiguration struct {
+	MaxSize             int64
+	Decompress          bool
+	MaxDecompressedSize int64
 }
 
-func buildFileWriter(config *logging.FileAppenderFactory) (io.Writer, error) {
-	writer := rotation.NewFile(config.CurrentLogFilename)
-	if err := writer.Open(); err != nil {
-		return nil, err
+// Build returns filters for limiting and decompressing request bodies.
+func (f *RequestBodyConfiguration) Build() []filter.Filter {
+	var filters []filter.Filter
+	if f.MaxSize > 0 {
+		filters = append(filters, body.NewLimitFilter(f.MaxSize))
 	}
-	if config.Archive {
-		triggeringPolicy := rotation.NewTimeTriggeringPolicy()
-		if err := triggeringPolicy.Start(); err != nil {
-			return nil, err
+	if f.Decompress {
+		n := f.MaxDecompressedSize
+		if n <= 0 {
+			n = defaultMaxDecompressedSize
 		}
-		rollingPolicy := rotation.NewTimeRollingPolicy()
-		rollingPolicy.FilePattern = config.ArchivedLogFilenamePattern
-		rollingPolicy.FileCount = config.ArchivedFileCount
+		filters = append(filters, body.NewDecompressFilter(n))
+	}
+	return filters
+}
+
+// SecurityConfiguration is the configuration for security headers.
+// Empty values use defaults of package security. HSTSMaxAge is a duration
+// string, "0" disables Strict-Transport-Security. Similarly, FrameOptions and
+// ReferrerPolicy of "-" disable X-Frame-Options and Referrer-Policy.
+// ContentSecurityPolicy can contain {nonce} which is replaced with a random
+// nonce for each request.
+type SecurityConfiguration struct {
+	Enabled               bool
+	HSTSMaxAge            string
+	HSTSIncludeSubDomains bool
+	FrameOptions          string
+	ReferrerPolicy        string
+	ContentSecurityPolicy string
+}
 
-		writer.SetTriggeringPolicy(triggeringPolicy)
-		writer.SetRollingPolicy(rollingPolicy)
-		// TODO: Close file
+// Build returns a security headers filter.
+func (f *SecurityConfiguration) Build() (filter.Filter, error) {
+	maxAge := security.DefaultHSTSMaxAge
+	if f.HSTSMaxAge != "" {
+		var err error
+		maxAge, err = time.ParseDuration(f.HSTSMaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("server: invalid HSTS max age %v: %v", f.HSTSMaxAge, err)
+		}
+	}
+	options := []security.Option{
+		security.WithHSTS(maxAge, f.HSTSIncludeSubDomains),
+	}
+	if f.FrameOptions != "" {
+		options = append(options, security.WithFrameOptions(headerValue(f.FrameOptions)))
+	}
+	if f.ReferrerPolicy != "" {
+		options = append(options, security.WithReferrerPolicy(headerValue(f.ReferrerPolicy)))
+	}
+	if f.ContentSecurityPolicy != "" {
+		options = append(options, security.WithContentSecurityPolicy(f.ContentSecurityPolicy))
 	}
-	return writer, nil
+	return security.NewFilter(options...), nil
+}
+
+// disabledHeader is the configuration value which disables a header.
+const disabledHeader = "-"
+
+// headerValue returns the header value of the configuration value s,
+// which is empty when the header is disabled.
+func headerValue(s string) string {
+	if s == disabledHeader {
+		return ""
+	}
+	return s
 }
 
 // GzipConfiguration indicates whether server should compress http response.
+// MinSize is the minimum size in bytes of responses to be compressed.
+// ContentTypes are media types to be compressed, e.g. text/*. Level is
+// compression level from 1 (best speed) to 9 (best compression), zero uses
+// the default level. Encodings are supported content codings in the order
+// of preference, default to gzip and deflate.
 type GzipConfiguration struct {
-	Enabled bool
+	Enabled      bool
+	MinSize      int
+	ContentTypes []string
+	Level        int
+	Encodings    []string
+}
+
+// Build returns a compression filter.
+func (f *GzipConfiguration) Build() (filter.Filter, error) {
+	var options []gzip.Option
+	if f.MinSize > 0 {
+		options = append(options, gzip.WithMinSize(f.MinSize))
+	}
+	if len(f.ContentTypes) > 0 {
+		options = append(options, gzip.WithContentTypes(f.ContentTypes...))
+	}
+	if f.Level != 0 {
+		if f.Level < 1 || f.Level > 9 {
+			return nil, fmt.Errorf("server: invalid gzip level %d", f.Level)
+		}
+		options = append(options, gzip.WithLevel(f.Level))
+	}
+	if len(f.Encodings) > 0 {
+		for _, name := range f.Encodings {
+			if !gzip.Supported(name) {
+				return nil, fmt.Errorf("server: unsupported gzip encoding %v", name)
+			}
+		}
+		options = append(options, gzip.WithEncodings(f.Encodings...))
+	}
+	return gzip.NewFilter(options...), nil
 }
 
 // resourceHandler allows user to register server filter.
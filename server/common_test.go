@@ -1,6 +1,9 @@
 package server
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/goburrow/melon/core"
@@ -19,34 +22,83 @@ func TestCommonFactory(t *testing.T) {
 	}
 }
 
-func TestRequestLogConfiguration(t *testing.T) {
+func TestRequestLogBuiltOnce(t *testing.T) {
 	appender := logging.AppenderConfiguration{}
 	appender.SetValue(&logging.ConsoleAppenderFactory{})
 
-	config := RequestLogConfiguration{
-		Appenders: []logging.AppenderConfiguration{
-			appender,
-		},
-	}
-
 	env := core.NewEnvironment()
-	filter, err := config.Build(env)
+	factory := commonFactory{}
+	factory.RequestLog.Appenders = []logging.AppenderConfiguration{appender}
+
+	err := factory.AddFilters(env, router.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestLog := factory.requestLog
+	err = factory.AddFilters(env, router.New())
 	if err != nil {
 		t.Fatal(err)
 	}
-	if filter == nil {
-		t.Fatalf("unexpected filter %#v", filter)
+	if requestLog == nil || requestLog.filter == nil || requestLog != factory.requestLog {
+		t.Fatalf("unexpected request log: %+v", factory.requestLog)
 	}
 }
 
-func TestNoRequestLogFactory(t *testing.T) {
+func TestAdminTimeout(t *testing.T) {
+	factory := commonFactory{}
+	factory.Timeout.Timeout = "1s"
 	env := core.NewEnvironment()
-	config := RequestLogConfiguration{}
-	filter, err := config.Build(env)
-	if err != nil {
+	appHandler := router.New()
+	adminHandler := router.New()
+	if err := factory.AddFilters(env, appHandler); err != nil {
 		t.Fatal(err)
 	}
-	if filter != nil {
-		t.Fatalf("unexpected filter %#v", filter)
+	if err := factory.AddAdminFilters(env, adminHandler); err != nil {
+		t.Fatal(err)
+	}
+	deadline := func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		fmt.Fprint(w, ok)
+	}
+	appHandler.Handle("GET", "/", http.HandlerFunc(deadline))
+	adminHandler.Handle("GET", "/", http.HandlerFunc(deadline))
+	w := httptest.NewRecorder()
+	appHandler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if "true" != w.Body.String() {
+		t.Fatalf("unexpected application deadline: %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	adminHandler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if "false" != w.Body.String() {
+		t.Fatalf("unexpected admin deadline: %s", w.Body.String())
+	}
+}
+
+func TestSecurityDisableHeaders(t *testing.T) {
+	serve := func(config SecurityConfiguration) http.Header {
+		f, err := config.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		f.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		return w.Header()
+	}
+	header := serve(SecurityConfiguration{})
+	if "DENY" != header.Get("X-Frame-Options") || "strict-origin-when-cross-origin" != header.Get("Referrer-Policy") {
+		t.Fatalf("unexpected headers: %v", header)
+	}
+	header = serve(SecurityConfiguration{
+		HSTSMaxAge:     "0",
+		FrameOptions:   "-",
+		ReferrerPolicy: "-",
+	})
+	for _, name := range []string{"Strict-Transport-Security", "X-Frame-Options", "Referrer-Policy"} {
+		if _, ok := header[name]; ok {
+			t.Fatalf("unexpected header %s: %v", name, header)
+		}
+	}
+	if "nosniff" != header.Get("X-Content-Type-Options") {
+		t.Fatalf("unexpected headers: %v", header)
 	}
 }
@@ -1,6 +1,11 @@
 package server
 
 import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
 	"github.com/goburrow/melon/core"
 	"github.com/goburrow/melon/server/router"
 )
@@ -12,6 +17,18 @@ type DefaultFactory struct {
 
 	ApplicationConnectors []Connector `valid:"notempty"`
 	AdminConnectors       []Connector `valid:"notempty"`
+	// ApplicationContexts are additional named applications which can be
+	// accessed from core.ServerEnvironment.Context.
+	ApplicationContexts []ApplicationContext
+}
+
+// ApplicationContext is a named application which has its own router, filters
+// and resources. It is served either on its own connectors or on application
+// connectors when Host header of the request matches one of its hosts.
+type ApplicationContext struct {
+	Name       string `valid:"notempty"`
+	Hosts      []string
+	Connectors []Connector
 }
 
 func newDefaultFactory() *DefaultFactory {
@@ -42,13 +59,29 @@ func (factory *DefaultFactory) BuildServer(env *core.Environment) (core.Managed,
 	adminHandler := router.New()
 	env.Admin.Router = adminHandler
 
-	err := factory.commonFactory.AddFilters(env, appHandler, adminHandler)
+	err := factory.commonFactory.AddFilters(env, appHandler)
+	if err != nil {
+		return nil, err
+	}
+	err = factory.commonFactory.AddAdminFilters(env, adminHandler)
 	if err != nil {
 		return nil, err
 	}
 
 	server := newServer()
-	err = server.addConnectors(appHandler, factory.ApplicationConnectors)
+	// Named application contexts
+	hosts := newHostHandler(appHandler)
+	for i := range factory.ApplicationContexts {
+		err = factory.buildContext(env, server, hosts, &factory.ApplicationContexts[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	var handler http.Handler = appHandler
+	if len(hosts.hosts) > 0 {
+		handler = hosts
+	}
+	err = server.addConnectors(handler, factory.ApplicationConnectors)
 	if err != nil {
 		return nil, err
 	}
@@ -58,3 +91,69 @@ func (factory *DefaultFactory) BuildServer(env *core.Environment) (core.Managed,
 	}
 	return server, nil
 }
+
+// buildContext adds the application context c to the server environment.
+func (factory *DefaultFactory) buildContext(env *core.Environment, server *server, hosts *hostHandler, c *ApplicationContext) error {
+	if c.Name == "" {
+		return fmt.Errorf("server: application context name is required")
+	}
+	if env.Server.Context(c.Name) != nil {
+		return fmt.Errorf("server: duplicated application context %s", c.Name)
+	}
+	if len(c.Hosts) == 0 && len(c.Connectors) == 0 {
+		return fmt.Errorf("server: application context %s has neither hosts nor connectors", c.Name)
+	}
+	handler := router.New()
+	ctx := env.Server.AddContext(c.Name)
+	ctx.Router = handler
+	ctx.AddResourceHandler(newResourceHandler(handler))
+
+	err := factory.commonFactory.AddFilters(env, handler)
+	if err != nil {
+		return err
+	}
+	for _, host := range c.Hosts {
+		if err = hosts.add(host, handler); err != nil {
+			return err
+		}
+	}
+	return server.addConnectors(handler, c.Connectors)
+}
+
+// hostHandler dispatches requests to handlers according to the Host header.
+type hostHandler struct {
+	hosts   map[string]http.Handler
+	handler http.Handler
+}
+
+func newHostHandler(defaultHandler http.Handler) *hostHandler {
+	return &hostHandler{
+		hosts:   make(map[string]http.Handler),
+		handler: defaultHandler,
+	}
+}
+
+func (h *hostHandler) add(host string, handler http.Handler) error {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if host == "" {
+		return fmt.Errorf("server: empty host")
+	}
+	if _, ok := h.hosts[host]; ok {
+		return fmt.Errorf("server: duplicated host %s", host)
+	}
+	h.hosts[host] = handler
+	return nil
+}
+
+// ServeHTTP uses the default handler when no hosts match.
+func (h *hostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if handler, ok := h.hosts[strings.ToLower(host)]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
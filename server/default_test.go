@@ -1,6 +1,8 @@
 package server
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/goburrow/melon/core"
@@ -26,3 +28,72 @@ func TestDefaultFactory(t *testing.T) {
 		t.Fatal("Admin.ServerHandler is nil")
 	}
 }
+
+func TestDefaultFactoryWithContexts(t *testing.T) {
+	env := core.NewEnvironment()
+	factory := &DefaultFactory{
+		ApplicationContexts: []ApplicationContext{
+			{Name: "internal", Hosts: []string{"internal.local"}},
+			{Name: "public", Connectors: []Connector{{Addr: "localhost:8082"}}},
+		},
+	}
+	_, err := factory.BuildServer(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Server.Contexts()) != 2 {
+		t.Fatalf("unexpected contexts: %#v", env.Server.Contexts())
+	}
+	internal := env.Server.Context("internal")
+	if internal == nil || internal.Router == nil || internal.Router == env.Server.Router {
+		t.Fatalf("unexpected internal context: %#v", internal)
+	}
+	if env.Server.Context("public") == nil {
+		t.Fatal("public context is nil")
+	}
+}
+
+func TestDefaultFactoryWithInvalidContexts(t *testing.T) {
+	tests := [][]ApplicationContext{
+		{{Name: ""}},
+		{{Name: "internal"}},
+		{{Name: "a", Hosts: []string{"a.local"}}, {Name: "a", Hosts: []string{"b.local"}}},
+		{{Name: "a", Hosts: []string{"a.local"}}, {Name: "b", Hosts: []string{"A.local"}}},
+	}
+	for _, test := range tests {
+		env := core.NewEnvironment()
+		factory := &DefaultFactory{
+			ApplicationContexts: test,
+		}
+		_, err := factory.BuildServer(env)
+		if err == nil {
+			t.Fatalf("error expected: %#v", test)
+		}
+	}
+}
+
+func TestHostHandler(t *testing.T) {
+	handler := func(s string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(s))
+		})
+	}
+	h := newHostHandler(handler("default"))
+	h.add("internal.local", handler("internal"))
+
+	tests := map[string]string{
+		"internal.local":      "internal",
+		"Internal.Local:8080": "internal",
+		"public.local":        "default",
+		"":                    "default",
+	}
+	for host, expected := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		h.ServeHTTP(w, r)
+		if expected != w.Body.String() {
+			t.Fatalf("unexpected response for host %q: %v", host, w.Body.String())
+		}
+	}
+}
@@ -5,9 +5,27 @@ package filter
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 )
 
+// Priorities of filters. Filters with lower priority are executed first.
+const (
+	PriorityRequestID   = 50
+	PrioritySecurity    = 75
+	PriorityRequestLog  = 100
+	PriorityTimeout     = 150
+	PriorityRecovery    = 200
+	PriorityRequestBody = 250
+	PriorityEncoding    = 300
+	PriorityPreAuth     = 400
+	PriorityAuth        = 500
+	PriorityPostAuth    = 600
+
+	// PriorityDefault is priority of filters which do not implement Prioritized.
+	PriorityDefault = PriorityPostAuth
+)
+
 // Filter performs filtering tasks on the request and response to a HTTP resource.
 // Filter is actually a http.Handler. To process the next filter, call Continue
 // in the handler.
@@ -15,7 +33,49 @@ type Filter interface {
 	http.Handler
 }
 
+// Prioritized is implemented by filters which need to be executed in a
+// specific phase.
+type Prioritized interface {
+	Priority() int
+}
+
+// Priority returns priority of filter f.
+func Priority(f Filter) int {
+	if p, ok := f.(Prioritized); ok {
+		return p.Priority()
+	}
+	return PriorityDefault
+}
+
+// Name returns type of filter f, or type of the underlying filter if f is
+// created by WithPriority.
+func Name(f Filter) string {
+	if p, ok := f.(*priorityFilter); ok {
+		return Name(p.Filter)
+	}
+	return fmt.Sprintf("%T", f)
+}
+
+// WithPriority returns a Filter executing f with the given priority.
+func WithPriority(f Filter, priority int) Filter {
+	return &priorityFilter{
+		Filter:   f,
+		priority: priority,
+	}
+}
+
+type priorityFilter struct {
+	Filter
+	priority int
+}
+
+func (f *priorityFilter) Priority() int {
+	return f.priority
+}
+
 // Chain is a http.Handler that executes all filters.
+// Filters in the chain must not be changed while serving requests. Filters
+// which continue the chain in another goroutine must use Fork.
 type Chain struct {
 	filters []Filter
 }
@@ -25,16 +85,32 @@ func NewChain() *Chain {
 	return &Chain{}
 }
 
-// ServeHTTP starts the filter chain.
+// ServeHTTP starts the filter chain. A cursor, which keeps track of the next
+// filter, is attached to the request context. When the chain is executed
+// inside another chain, the existing cursor is reused and restored afterward,
+// so only the outermost chain allocates it.
+//
+// As Continue finds the next filter only from the request, the outermost
+// chain always allocates the cursor and a shallow copy of the request, even
+// if handlers were linked in advance. Nested chains, e.g. router groups,
+// do not allocate.
 func (chain *Chain) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	c := *chain
-	if len(c.filters) == 0 {
+	if len(chain.filters) == 0 {
+		return
+	}
+	if c := fromContext(r.Context()); c != nil {
+		parent, next := c.chain, c.next
+		c.chain, c.next = chain, 1
+		chain.filters[0].ServeHTTP(w, r)
+		c.chain, c.next = parent, next
 		return
 	}
-	f := c.filters[0]
-	c.filters = c.filters[1:]
-	ctx := newContext(r.Context(), &c)
-	f.ServeHTTP(w, r.WithContext(ctx))
+	c := &cursor{
+		Context: r.Context(),
+		chain:   chain,
+		next:    1,
+	}
+	chain.filters[0].ServeHTTP(w, r.WithContext(c))
 }
 
 // Add adds the given filter into the end of the chain.
@@ -53,6 +129,32 @@ func (chain *Chain) Insert(f Filter, idx int) bool {
 	return true
 }
 
+// InsertSorted inserts the filter before the first filter which has higher
+// priority, but not after the last n filters of the chain.
+func (chain *Chain) InsertSorted(f Filter, n int) {
+	end := len(chain.filters) - n
+	if end < 0 {
+		end = 0
+	}
+	p := Priority(f)
+	idx := end
+	for i := 0; i < end; i++ {
+		if Priority(chain.filters[i]) > p {
+			idx = i
+			break
+		}
+	}
+	chain.filters = append(chain.filters, nil)
+	copy(chain.filters[idx+1:], chain.filters[idx:])
+	chain.filters[idx] = f
+}
+
+// Filters returns all filters in the chain. The returned slice must not be
+// modified.
+func (chain *Chain) Filters() []Filter {
+	return chain.filters
+}
+
 // Length returns length of the chain.
 func (chain *Chain) Length() int {
 	return len(chain.filters)
@@ -60,15 +162,31 @@ func (chain *Chain) Length() int {
 
 // Continue runs next filter in the chain c.
 func Continue(w http.ResponseWriter, r *http.Request) {
-	chain := fromContext(r.Context())
-	if chain == nil || len(chain.filters) == 0 {
+	c := fromContext(r.Context())
+	if c == nil || c.next >= len(c.chain.filters) {
 		return
 	}
-	f := chain.filters[0]
-	chain.filters = chain.filters[1:]
+	f := c.chain.filters[c.next]
+	c.next++
 	f.ServeHTTP(w, r)
 }
 
+// Fork returns a shallow copy of r which has its own cursor of the filter
+// chain. The cursor of a request is shared by all chains serving it, so a
+// filter must call Continue with a forked request when it continues the
+// chain in another goroutine, e.g. to stop waiting for a slow handler.
+func Fork(r *http.Request) *http.Request {
+	c := fromContext(r.Context())
+	if c == nil {
+		return r
+	}
+	return r.WithContext(&cursor{
+		Context: r.Context(),
+		chain:   c.chain,
+		next:    c.next,
+	})
+}
+
 // If is a filter which executes the underlying filter only when requests/responses
 // meet specific condition.
 type If struct {
@@ -76,6 +194,11 @@ type If struct {
 	C func(w http.ResponseWriter, r *http.Request) bool // condition
 }
 
+// Priority returns priority of filter F.
+func (f *If) Priority() int {
+	return Priority(f.F)
+}
+
 // ServeHTTP skips filter F if contition C returns false.
 func (f *If) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if f.C(w, r) {
@@ -94,15 +217,28 @@ func (c *contextKey) String() string {
 	return "melon/server context value " + c.name
 }
 
-var chainContextKey = &contextKey{"chain"}
+var cursorContextKey = &contextKey{"cursor"}
 
-func newContext(ctx context.Context, chain *Chain) context.Context {
-	return context.WithValue(ctx, chainContextKey, chain)
+// cursor is the request context which points to the next filter in the chain.
+// It saves allocating a context.WithValue for each request.
+type cursor struct {
+	context.Context
+
+	chain *Chain
+	next  int
+}
+
+// Value returns cursor itself for cursorContextKey.
+func (c *cursor) Value(key interface{}) interface{} {
+	if key == cursorContextKey {
+		return c
+	}
+	return c.Context.Value(key)
 }
 
-func fromContext(ctx context.Context) *Chain {
-	if chain, ok := ctx.Value(chainContextKey).(*Chain); ok {
-		return chain
+func fromContext(ctx context.Context) *cursor {
+	if c, ok := ctx.Value(cursorContextKey).(*cursor); ok {
+		return c
 	}
 	return nil
 }
@@ -1,8 +1,10 @@
 package filter
 
 import (
+	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
 )
 
@@ -63,6 +65,79 @@ func TestInsertFilter(t *testing.T) {
 	}
 }
 
+func TestNestedChain(t *testing.T) {
+	inner := NewChain()
+	inner.Add(testFilter("b"), endHandler)
+	chain := NewChain()
+	chain.Add(testFilter("a"), inner, testFilter("c"))
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		chain.ServeHTTP(w, r)
+		if "abEND" != w.Body.String() {
+			t.Fatalf("unexpected body: %v", w.Body.String())
+		}
+	}
+	// Continue after inner chain
+	after := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r)
+		Continue(w, r)
+	})
+	chain = NewChain()
+	chain.Add(testFilter("a"), after, testFilter("c"), endHandler)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	chain.ServeHTTP(w, r)
+	if "abENDcEND" != w.Body.String() {
+		t.Fatalf("unexpected body: %v", w.Body.String())
+	}
+}
+
+func TestFork(t *testing.T) {
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	write := func(s string) {
+		mu.Lock()
+		buf.WriteString(s)
+		mu.Unlock()
+	}
+	done := make(chan struct{})
+	// async continues the chain in another goroutine and returns immediately.
+	async := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = Fork(r)
+		go func() {
+			defer close(done)
+			Continue(w, r)
+		}()
+	})
+	released := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-released
+		write("slow")
+		Continue(w, r)
+	})
+	inner := NewChain()
+	inner.Add(async, slow)
+	outer := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write("a")
+		Continue(w, r)
+	})
+	last := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write("b")
+	})
+	chain := NewChain()
+	chain.Add(outer, inner, last)
+
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	close(released)
+	<-done
+	// Filter after the inner chain must not be executed by the goroutine.
+	if "aslow" != buf.String() {
+		t.Fatalf("unexpected filters: %v", buf.String())
+	}
+}
+
 func TesIf(t *testing.T) {
 	condTrue := func(http.ResponseWriter, *http.Request) bool {
 		return true
@@ -85,3 +160,82 @@ func TesIf(t *testing.T) {
 		t.Fatalf("unexpected body: %v", w.Body.String())
 	}
 }
+
+func TestInsertSorted(t *testing.T) {
+	chain := NewChain()
+	chain.Add(endHandler)
+
+	chain.InsertSorted(testFilter("3"), 1)
+	chain.InsertSorted(WithPriority(testFilter("1"), PriorityRequestLog), 1)
+	chain.InsertSorted(WithPriority(testFilter("2"), PriorityAuth), 1)
+	chain.InsertSorted(testFilter("4"), 1)
+	chain.InsertSorted(&If{testFilter("0"), func(http.ResponseWriter, *http.Request) bool { return true }}, 1)
+	chain.InsertSorted(&If{WithPriority(testFilter("5"), PriorityRequestLog), func(http.ResponseWriter, *http.Request) bool { return true }}, 1)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	chain.ServeHTTP(w, r)
+	if "152340END" != w.Body.String() {
+		t.Fatalf("unexpected body: %v", w.Body.String())
+	}
+	if "filter.testFilter" != Name(WithPriority(testFilter("1"), 0)) {
+		t.Fatalf("unexpected name: %v", Name(WithPriority(testFilter("1"), 0)))
+	}
+}
+
+func TestChainAllocs(t *testing.T) {
+	end := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	chain := NewChain()
+	chain.Add(nopFilter{}, nopFilter{}, end)
+	inner := NewChain()
+	inner.Add(nopFilter{}, end)
+	nested := NewChain()
+	nested.Add(nopFilter{}, inner)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	// Cursor and request with the cursor context.
+	if n := testing.AllocsPerRun(100, func() { chain.ServeHTTP(w, r) }); n != 2 {
+		t.Fatalf("unexpected allocations: %v", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { nested.ServeHTTP(w, r) }); n != 2 {
+		t.Fatalf("unexpected allocations of nested chain: %v", n)
+	}
+}
+
+type nopFilter struct{}
+
+func (nopFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	Continue(w, r)
+}
+
+func BenchmarkChain(b *testing.B) {
+	chain := NewChain()
+	chain.Add(nopFilter{}, nopFilter{}, nopFilter{}, nopFilter{})
+	chain.Add(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkNestedChain(b *testing.B) {
+	inner := NewChain()
+	inner.Add(nopFilter{}, nopFilter{})
+	inner.Add(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	chain := NewChain()
+	chain.Add(nopFilter{}, nopFilter{})
+	chain.Add(inner)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain.ServeHTTP(w, r)
+	}
+}
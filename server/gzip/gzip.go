@@ -3,72 +3,441 @@ package gzip
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
+	"compress/zlib"
 	"errors"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/goburrow/melon/core"
 	"github.com/goburrow/melon/server/filter"
 )
 
-// gzipFilter is a filter which compress http responses using gzip.
-type gzipFilter struct{}
+// Compressor is a writer compressing data with a content coding.
+// Compressors are reused after Reset.
+type Compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// EncoderFunc returns a Compressor writing to w with the given compression level.
+type EncoderFunc func(w io.Writer, level int) (Compressor, error)
+
+var (
+	encodersMu sync.RWMutex
+	encoders   = map[string]EncoderFunc{
+		"gzip":    newGzipWriter,
+		"deflate": newZlibWriter,
+	}
+)
+
+// RegisterEncoder makes an additional content coding, such as br, available
+// to the filter. It is not safe to call RegisterEncoder after filters are created.
+func RegisterEncoder(name string, fn EncoderFunc) {
+	encodersMu.Lock()
+	encoders[strings.ToLower(name)] = fn
+	encodersMu.Unlock()
+}
+
+// Supported returns true if content coding name is registered.
+func Supported(name string) bool {
+	return getEncoder(name) != nil
+}
+
+func getEncoder(name string) EncoderFunc {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	return encoders[strings.ToLower(name)]
+}
+
+func newGzipWriter(w io.Writer, level int) (Compressor, error) {
+	return gzip.NewWriterLevel(w, level)
+}
+
+func newZlibWriter(w io.Writer, level int) (Compressor, error) {
+	return zlib.NewWriterLevel(w, level)
+}
+
+var (
+	defaultEncodings    = []string{"gzip", "deflate"}
+	defaultContentTypes = []string{
+		"text/*",
+		"application/javascript",
+		"application/json",
+		"application/x-javascript",
+		"application/xhtml+xml",
+		"application/xml",
+		"image/svg+xml",
+	}
+)
+
+// encoder is a content coding enabled in the filter.
+type encoder struct {
+	name string
+	// pool contains Compressors as creating them is expensive.
+	pool *sync.Pool
+}
+
+func newEncoder(name string, fn EncoderFunc, level int) (*encoder, error) {
+	// Validate compression level.
+	if _, err := fn(ioutil.Discard, level); err != nil {
+		return nil, err
+	}
+	return &encoder{
+		name: strings.ToLower(name),
+		pool: &sync.Pool{
+			New: func() interface{} {
+				cw, _ := fn(ioutil.Discard, level)
+				return cw
+			},
+		},
+	}, nil
+}
+
+func (e *encoder) get(w io.Writer) Compressor {
+	cw := e.pool.Get().(Compressor)
+	cw.Reset(w)
+	return cw
+}
+
+func (e *encoder) put(cw Compressor) {
+	e.pool.Put(cw)
+}
 
-// NewFilter allocates and returns a new Filter which compresses HTTP responses using gzip.
-func NewFilter() filter.Filter {
-	return &gzipFilter{}
+// gzipFilter is a filter which compress http responses.
+type gzipFilter struct {
+	encodings    []string
+	encoders     []*encoder
+	contentTypes []string
+	minSize      int
+	level        int
+}
+
+// Option is a Filter option.
+type Option func(f *gzipFilter)
+
+// NewFilter allocates and returns a new Filter which compresses HTTP responses
+// using gzip or deflate, depending on Accept-Encoding of the request.
+// By default, only text, JavaScript, JSON and XML responses are compressed.
+// It panics if an encoding is not registered or the compression level is invalid.
+func NewFilter(options ...Option) filter.Filter {
+	f := &gzipFilter{
+		encodings:    defaultEncodings,
+		contentTypes: defaultContentTypes,
+		level:        gzip.DefaultCompression,
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	for _, name := range f.encodings {
+		fn := getEncoder(name)
+		if fn == nil {
+			panic("melon/gzip: unsupported encoding " + name)
+		}
+		enc, err := newEncoder(name, fn, f.level)
+		if err != nil {
+			panic("melon/gzip: " + err.Error())
+		}
+		f.encoders = append(f.encoders, enc)
+	}
+	return f
+}
+
+// WithEncodings sets content codings supported by the filter in the order
+// of preference. Additional encodings must be registered with RegisterEncoder.
+func WithEncodings(names ...string) Option {
+	return func(f *gzipFilter) {
+		f.encodings = names
+	}
+}
+
+// WithContentTypes sets media types of responses to be compressed.
+// A media type can be a wildcard like text/*.
+func WithContentTypes(types ...string) Option {
+	return func(f *gzipFilter) {
+		f.contentTypes = types
+	}
+}
+
+// WithMinSize sets minimum size of responses to be compressed. Response body
+// is buffered until it reaches the size.
+func WithMinSize(n int) Option {
+	return func(f *gzipFilter) {
+		f.minSize = n
+	}
+}
+
+// WithLevel sets compression level, e.g. gzip.BestSpeed.
+func WithLevel(level int) Option {
+	return func(f *gzipFilter) {
+		f.level = level
+	}
+}
+
+// Priority returns filter.PriorityEncoding.
+func (f *gzipFilter) Priority() int {
+	return filter.PriorityEncoding
 }
 
 func (f *gzipFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ae := r.Header.Get("Accept-Encoding")
-	if ae != "" && strings.Contains(ae, "gzip") {
-		gzWriter := &responseWriter{
-			ResponseWriter: w,
-			gz:             gzip.NewWriter(w),
+	w.Header().Add("Vary", "Accept-Encoding")
+	// Response of HEAD request has no body.
+	var enc *encoder
+	if r.Method != "HEAD" {
+		enc = f.negotiate(r.Header.Get("Accept-Encoding"))
+	}
+	if enc == nil {
+		filter.Continue(w, r)
+		return
+	}
+	gzWriter := &responseWriter{
+		ResponseWriter: w,
+		filter:         f,
+		encoder:        enc,
+	}
+	// Handlers only know ETags of uncompressed representations.
+	for _, name := range conditionalHeaders {
+		if v := r.Header.Get(name); v != "" {
+			if etags, ok := f.stripETags(v); ok {
+				r.Header.Set(name, etags)
+				gzWriter.conditional = true
+			}
 		}
-		defer gzWriter.gz.Close()
-		w = gzWriter
 	}
-	filter.Continue(w, r)
+	defer gzWriter.Close()
+	filter.Continue(gzWriter, r)
 }
 
+var conditionalHeaders = []string{"If-None-Match", "If-Match"}
+
+// stripETags removes encoding suffixes, which are added by the filter,
+// from entity tags in header value v.
+func (f *gzipFilter) stripETags(v string) (string, bool) {
+	stripped := false
+	for _, enc := range f.encoders {
+		suffix := "-" + enc.name + `"`
+		if strings.Contains(v, suffix) {
+			v = strings.Replace(v, suffix, `"`, -1)
+			stripped = true
+		}
+	}
+	return v, stripped
+}
+
+// etag adds encoding suffix to strong entity tag.
+func etag(v, encoding string) string {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		// Weak ETag is still valid for compressed representation.
+		return v
+	}
+	return v[:len(v)-1] + "-" + encoding + `"`
+}
+
+// negotiate returns the encoder with highest quality value in Accept-Encoding
+// header or nil if none is acceptable.
+func (f *gzipFilter) negotiate(acceptEncoding string) *encoder {
+	if acceptEncoding == "" {
+		return nil
+	}
+	var best *encoder
+	var bestQ float64
+	for _, enc := range f.encoders {
+		q := quality(acceptEncoding, enc.name)
+		if q > bestQ {
+			best = enc
+			bestQ = q
+		}
+	}
+	return best
+}
+
+// quality returns q-value of the content coding in Accept-Encoding header.
+func quality(acceptEncoding, name string) float64 {
+	q := -1.0
+	wildcard := 0.0
+	for _, s := range strings.Split(acceptEncoding, ",") {
+		coding, v := parseQuality(s)
+		switch {
+		case strings.EqualFold(coding, name), name == "gzip" && strings.EqualFold(coding, "x-gzip"):
+			if v > q {
+				q = v
+			}
+		case coding == "*":
+			wildcard = v
+		}
+	}
+	if q < 0 {
+		return wildcard
+	}
+	return q
+}
+
+// parseQuality parses content coding and its q-value, e.g. gzip;q=0.5.
+func parseQuality(s string) (string, float64) {
+	params := strings.Split(s, ";")
+	coding := strings.TrimSpace(params[0])
+	q := 1.0
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		if len(p) > 2 && (p[0] == 'q' || p[0] == 'Q') && p[1] == '=' {
+			v, err := strconv.ParseFloat(p[2:], 64)
+			if err != nil || v < 0 || v > 1 {
+				v = 0
+			}
+			q = v
+		}
+	}
+	return coding, q
+}
+
+// compressible returns true if contentType is in the allowed list.
+func (f *gzipFilter) compressible(contentType string) bool {
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	if contentType == "" {
+		return false
+	}
+	for _, t := range f.contentTypes {
+		if t == contentType || t == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(contentType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseWriter buffers response until it is decided whether to compress.
 type responseWriter struct {
 	http.ResponseWriter
 
-	gz *gzip.Writer
+	filter  *gzipFilter
+	encoder *encoder
 
-	headerWritten bool
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	closed  bool
+	// conditional is true when request has ETags of compressed representation.
+	conditional bool
+	// cw is not nil when response is being compressed.
+	cw Compressor
 }
 
 func (w *responseWriter) Write(p []byte) (int, error) {
-	if w.Header().Get("Content-Type") == "" {
-		w.Header().Set("Content-Type", http.DetectContentType(p))
+	if w.decided {
+		if w.cw != nil {
+			return w.cw.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
 	}
-	if !w.headerWritten {
-		w.WriteHeader(http.StatusOK)
+	n, _ := w.buf.Write(p)
+	if w.buf.Len() > 0 && w.buf.Len() >= w.filter.minSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
 	}
-	return w.gz.Write(p)
+	return n, nil
 }
 
 func (w *responseWriter) WriteHeader(status int) {
-	w.Header().Set("Content-Encoding", "gzip")
-	w.Header().Add("Vary", "Accept-Encoding")
-	// FIXME: Correct content length for small response.
-	w.Header().Del("Content-Length")
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = status
+	if !bodyAllowed(status) {
+		if status == http.StatusNotModified && w.conditional {
+			if v := w.Header().Get("ETag"); v != "" {
+				w.Header().Set("ETag", etag(v, w.encoder.name))
+			}
+		}
+		w.decide(false)
+	}
+}
+
+// bodyAllowed returns true if response of the status can have a body.
+func bodyAllowed(status int) bool {
+	switch {
+	case status >= 100 && status <= 199:
+		return false
+	case status == http.StatusNoContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// decide writes response header and buffered data. Response is compressed
+// if compress is true and its content type is allowed.
+func (w *responseWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if header.Get("Content-Type") == "" && w.buf.Len() > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if compress && header.Get("Content-Encoding") == "" && w.filter.compressible(header.Get("Content-Type")) {
+		w.cw = w.encoder.get(w.ResponseWriter)
+		header.Set("Content-Encoding", w.encoder.name)
+		header.Del("Content-Length")
+		if v := header.Get("ETag"); v != "" {
+			header.Set("ETag", etag(v, w.encoder.name))
+		}
+	} else if w.closed && w.buf.Len() > 0 && header.Get("Content-Length") == "" {
+		// Whole response is in the buffer.
+		header.Set("Content-Length", strconv.Itoa(w.buf.Len()))
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.buf.Len() > 0 {
+		_, err := w.Write(w.buf.Bytes())
+		w.buf.Reset()
+		return err
+	}
+	return nil
+}
 
-	w.ResponseWriter.WriteHeader(status)
-	w.headerWritten = true
+// Close writes buffered response and finishes compression.
+func (w *responseWriter) Close() {
+	w.closed = true
+	if !w.decided {
+		if w.status == 0 && w.buf.Len() == 0 {
+			// Nothing has been written.
+			return
+		}
+		w.decide(w.buf.Len() > 0 && w.buf.Len() >= w.filter.minSize)
+	}
+	if w.cw != nil {
+		if err := w.cw.Close(); err != nil {
+			core.GetLogger("melon/server").Warnf("%s response writer close: %v", w.encoder.name, err)
+		}
+		w.encoder.put(w.cw)
+		w.cw = nil
+	}
 }
 
 // Flush implements http.Flusher.
 func (w *responseWriter) Flush() {
-	err := w.gz.Flush()
-	if err != nil {
-		core.GetLogger("melon/server").Warnf("gzip response writer flush: %v", err)
+	if !w.decided {
+		// Streaming response is compressed regardless of its size.
+		w.decide(true)
+	}
+	if w.cw != nil {
+		err := w.cw.Flush()
+		if err != nil {
+			core.GetLogger("melon/server").Warnf("%s response writer flush: %v", w.encoder.name, err)
+		}
 	}
-
 	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
 		fl.Flush()
 	}
@@ -77,6 +446,7 @@ func (w *responseWriter) Flush() {
 // Hijack implements http.Hijacker.
 func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.decided = true
 		return hj.Hijack()
 	}
 	return nil, nil, errors.New("not a Hijacker")
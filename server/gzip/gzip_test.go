@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 
 	"github.com/goburrow/melon/server/filter"
@@ -94,3 +95,177 @@ func TestGZipResponse(t *testing.T) {
 		t.Fatalf("unexpected body: %v", body)
 	}
 }
+
+func TestNegotiate(t *testing.T) {
+	f := NewFilter().(*gzipFilter)
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"x-gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"gzip;q=0.5, deflate;q=0.8", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"*", "gzip"},
+		{"*;q=0.5, gzip;q=0", "deflate"},
+		{"*;q=0", ""},
+		{"br", ""},
+	}
+	for _, test := range tests {
+		enc := f.negotiate(test.acceptEncoding)
+		name := ""
+		if enc != nil {
+			name = enc.name
+		}
+		if test.encoding != name {
+			t.Fatalf("unexpected encoding for %q: %v", test.acceptEncoding, name)
+		}
+	}
+}
+
+func TestMinSize(t *testing.T) {
+	chain := filter.NewChain()
+	chain.Add(NewFilter(WithMinSize(4)), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Query().Get("s")))
+		w.Write([]byte(r.URL.Query().Get("s")))
+	}))
+	tests := []struct {
+		s        string
+		encoding string
+		length   string
+	}{
+		{"a", "", "2"},
+		{"ab", "gzip", ""},
+		{"abc", "gzip", ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/?s="+test.s, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		chain.ServeHTTP(w, r)
+		if test.encoding != w.Header().Get("Content-Encoding") || test.length != w.Header().Get("Content-Length") {
+			t.Fatalf("unexpected headers for %s: %v", test.s, w.Header())
+		}
+		if "Accept-Encoding" != w.Header().Get("Vary") {
+			t.Fatalf("unexpected headers for %s: %v", test.s, w.Header())
+		}
+	}
+}
+
+func TestContentTypes(t *testing.T) {
+	chain := filter.NewChain()
+	chain.Add(NewFilter(WithContentTypes("application/json", "text/*"), WithEncodings("deflate"), WithLevel(gzip.BestSpeed)),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ct := r.URL.Query().Get("type"); ct != "" {
+				w.Header().Set("Content-Type", ct)
+			}
+			w.Write([]byte("{}"))
+		}))
+	tests := []struct {
+		contentType string
+		encoding    string
+	}{
+		{"", "deflate"},
+		{"application/json; charset=utf-8", "deflate"},
+		{"text/html", "deflate"},
+		{"image/png", ""},
+		{"application/zip", ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/?type="+url.QueryEscape(test.contentType), nil)
+		r.Header.Set("Accept-Encoding", "gzip, deflate")
+		chain.ServeHTTP(w, r)
+		if test.encoding != w.Header().Get("Content-Encoding") {
+			t.Fatalf("unexpected headers for %s: %v", test.contentType, w.Header())
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	chain := filter.NewChain()
+	chain.Add(NewFilter(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := r.URL.Query().Get("etag")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	tests := []struct {
+		etag        string
+		ifNoneMatch string
+		status      int
+		response    string
+	}{
+		{`"a"`, "", http.StatusOK, `"a-gzip"`},
+		{`W/"a"`, "", http.StatusOK, `W/"a"`},
+		{`"a"`, `"a-gzip"`, http.StatusNotModified, `"a-gzip"`},
+		{`"a"`, `"b-gzip"`, http.StatusOK, `"a-gzip"`},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/?etag="+url.QueryEscape(test.etag), nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		if test.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		chain.ServeHTTP(w, r)
+		if test.status != w.Code || test.response != w.Header().Get("ETag") {
+			t.Fatalf("unexpected response for %+v: %v %v", test, w.Code, w.Header())
+		}
+		if test.status == http.StatusNotModified && (w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "") {
+			t.Fatalf("unexpected response for %+v: %v %q", test, w.Header(), w.Body)
+		}
+	}
+}
+
+func TestNoBody(t *testing.T) {
+	chain := filter.NewChain()
+	chain.Add(NewFilter(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"HEAD", "/", http.StatusOK},
+		{"GET", "/empty", http.StatusNoContent},
+		{"DELETE", "/empty", http.StatusNoContent},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.method, test.path, nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+		chain.ServeHTTP(w, r)
+		if test.status != w.Code || "" != w.Header().Get("Content-Encoding") {
+			t.Fatalf("unexpected response for %+v: %v %v", test, w.Code, w.Header())
+		}
+		if test.status == http.StatusNoContent && w.Body.Len() != 0 {
+			t.Fatalf("unexpected body for %+v: %q", test, w.Body)
+		}
+	}
+}
+
+func BenchmarkGZip(b *testing.B) {
+	chain := filter.NewChain()
+	chain.Add(NewFilter(), http.HandlerFunc(handler))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chain.ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
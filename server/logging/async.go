@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/codahale/metrics"
+	"github.com/goburrow/gol"
+)
+
+// DefaultQueueSize is the default number of entries buffered by AsyncWriter.
+const DefaultQueueSize = 1024
+
+var errWriterClosed = errors.New("melon/logging: writer closed")
+
+// AsyncWriter writes to the underlying writer in a separate goroutine so that
+// requests are not blocked by the request log. Entries are dropped when
+// the queue is full. AsyncWriter implements core.Managed and LevelWriter.
+type AsyncWriter struct {
+	writer  io.Writer
+	queue   chan asyncEntry
+	done    chan struct{}
+	dropped uint64
+
+	metricDropped metrics.Counter
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewAsyncWriter returns a new AsyncWriter which buffers up to size entries.
+func NewAsyncWriter(writer io.Writer, size int) *AsyncWriter {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	w := &AsyncWriter{
+		writer: writer,
+		queue:  make(chan asyncEntry, size),
+		done:   make(chan struct{}),
+
+		metricDropped: metrics.Counter("HTTP.RequestLog.Dropped"),
+	}
+	go w.run()
+	return w
+}
+
+type asyncEntry struct {
+	level gol.Level
+	line  []byte
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.done)
+	lw, _ := w.writer.(LevelWriter)
+	for e := range w.queue {
+		if lw != nil {
+			lw.WriteLevel(e.level, e.line)
+		} else {
+			w.writer.Write(e.line)
+		}
+	}
+}
+
+// Write queues a copy of p with level gol.Info. It never blocks.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(gol.Info, p)
+}
+
+// WriteLevel queues a copy of p. It never blocks.
+func (w *AsyncWriter) WriteLevel(level gol.Level, p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	e := asyncEntry{
+		level: level,
+		line:  make([]byte, len(p)),
+	}
+	copy(e.line, p)
+	select {
+	case w.queue <- e:
+	default:
+		atomic.AddUint64(&w.dropped, 1)
+		w.metricDropped.Add()
+	}
+	return len(p), nil
+}
+
+// Dropped returns number of entries dropped because the queue was full.
+func (w *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// Start does nothing as the writer is started when created.
+func (w *AsyncWriter) Start() error {
+	return nil
+}
+
+// Stop writes remaining entries and stops the writer.
+func (w *AsyncWriter) Stop() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+	return nil
+}
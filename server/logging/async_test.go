@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+)
+
+// blockingWriter blocks until it is released.
+type blockingWriter struct {
+	buf     bytes.Buffer
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.buf.Write(p)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	bw := &blockingWriter{release: make(chan struct{})}
+	w := NewAsyncWriter(bw, 2)
+	for _, s := range []string{"1", "2", "3", "4", "5"} {
+		n, err := w.Write([]byte(s))
+		if err != nil || n != 1 {
+			t.Fatalf("unexpected write: %v %v", n, err)
+		}
+	}
+	// The first entry may be taken by the writer goroutine.
+	dropped := w.Dropped()
+	if dropped != 2 && dropped != 3 {
+		t.Fatalf("unexpected dropped: %v", dropped)
+	}
+	close(bw.release)
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if uint64(5-bw.buf.Len()) != dropped {
+		t.Fatalf("unexpected output %q, dropped: %v", bw.buf.String(), dropped)
+	}
+	if _, err := w.Write([]byte("6")); err == nil {
+		t.Fatal("error expected")
+	}
+}
@@ -0,0 +1,324 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	clfTimeFormat  = "02/Jan/2006:15:04:05 -0700"
+	jsonTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+)
+
+// Formatter formats request log entries.
+type Formatter interface {
+	// Format writes entry e as a line to buf.
+	Format(buf *bytes.Buffer, e *Entry)
+}
+
+// FormatOption is an option of built-in formatters.
+type FormatOption func(o *formatOptions)
+
+type formatOptions struct {
+	location    *time.Location
+	latencyUnit time.Duration
+}
+
+func newFormatOptions(options []FormatOption) formatOptions {
+	o := formatOptions{
+		latencyUnit: time.Millisecond,
+	}
+	for _, opt := range options {
+		opt(&o)
+	}
+	return o
+}
+
+// WithLocation sets time zone of request time. Local time is used by default.
+func WithLocation(loc *time.Location) FormatOption {
+	return func(o *formatOptions) {
+		o.location = loc
+	}
+}
+
+// WithLatencyUnit sets unit of latency, either time.Millisecond (default)
+// or time.Microsecond.
+func WithLatencyUnit(unit time.Duration) FormatOption {
+	return func(o *formatOptions) {
+		o.latencyUnit = unit
+	}
+}
+
+func (o *formatOptions) time(t time.Time) time.Time {
+	if o.location != nil {
+		return t.In(o.location)
+	}
+	return t
+}
+
+func (o *formatOptions) latency(d time.Duration) int64 {
+	return int64(d / o.latencyUnit)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// commonFormat is the Common Log Format extended with referer, user agent,
+// latency and request ID.
+type commonFormat struct {
+	formatOptions
+}
+
+// NewCommonFormat returns a Formatter which writes Common Log Format with
+// additional referer, user agent, latency and request ID.
+func NewCommonFormat(options ...FormatOption) Formatter {
+	return &commonFormat{newFormatOptions(options)}
+}
+
+func (f *commonFormat) Format(buf *bytes.Buffer, e *Entry) {
+	r := e.Request
+	fmt.Fprintf(buf, "%s %s %s [%s] \"%s %s %s\" %d %d %q %q %d %q\n",
+		getRemoteAddr(r),
+		"-", // Identity is not supported.
+		orDash(e.Principal),
+		f.time(e.Time).Format(clfTimeFormat),
+		r.Method,
+		r.RequestURI,
+		r.Proto,
+		e.Status,
+		e.Size,
+		orDash(r.Referer()),
+		orDash(r.UserAgent()),
+		f.latency(e.Latency),
+		e.RequestID,
+	)
+}
+
+// combinedFormat is the Combined Log Format used by Apache and Nginx.
+type combinedFormat struct {
+	formatOptions
+}
+
+// NewCombinedFormat returns a Formatter which writes Combined Log Format.
+func NewCombinedFormat(options ...FormatOption) Formatter {
+	return &combinedFormat{newFormatOptions(options)}
+}
+
+func (f *combinedFormat) Format(buf *bytes.Buffer, e *Entry) {
+	r := e.Request
+	fmt.Fprintf(buf, "%s - %s [%s] \"%s %s %s\" %d %d %q %q\n",
+		getRemoteAddr(r),
+		orDash(e.Principal),
+		f.time(e.Time).Format(clfTimeFormat),
+		r.Method,
+		r.RequestURI,
+		r.Proto,
+		e.Status,
+		e.Size,
+		orDash(r.Referer()),
+		orDash(r.UserAgent()),
+	)
+}
+
+// jsonFormat writes each entry as a JSON object in a line.
+type jsonFormat struct {
+	formatOptions
+}
+
+// NewJSONFormat returns a Formatter which writes JSON lines.
+func NewJSONFormat(options ...FormatOption) Formatter {
+	return &jsonFormat{newFormatOptions(options)}
+}
+
+type jsonEntry struct {
+	Time       string `json:"time"`
+	RemoteAddr string `json:"remote_addr"`
+	Method     string `json:"method"`
+	URI        string `json:"uri"`
+	Proto      string `json:"proto"`
+	Status     int    `json:"status"`
+	Size       uint64 `json:"size"`
+	Referer    string `json:"referer,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	LatencyMS  *int64 `json:"latency_ms,omitempty"`
+	LatencyUS  *int64 `json:"latency_us,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	Principal  string `json:"principal,omitempty"`
+	Route      string `json:"route,omitempty"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+}
+
+func (f *jsonFormat) Format(buf *bytes.Buffer, e *Entry) {
+	r := e.Request
+	latency := f.latency(e.Latency)
+	entry := jsonEntry{
+		Time:       f.time(e.Time).Format(jsonTimeFormat),
+		RemoteAddr: getRemoteAddr(r),
+		Method:     r.Method,
+		URI:        r.RequestURI,
+		Proto:      r.Proto,
+		Status:     e.Status,
+		Size:       e.Size,
+		Referer:    r.Referer(),
+		UserAgent:  r.UserAgent(),
+		RequestID:  e.RequestID,
+		Principal:  e.Principal,
+		Route:      e.Route,
+		TimedOut:   e.TimedOut,
+	}
+	if f.latencyUnit == time.Microsecond {
+		entry.LatencyUS = &latency
+	} else {
+		entry.LatencyMS = &latency
+	}
+	// Encoder appends a new line.
+	json.NewEncoder(buf).Encode(&entry)
+}
+
+// templateFormat writes entries according to a template.
+type templateFormat struct {
+	formatOptions
+	parts []func(buf *bytes.Buffer, e *Entry)
+}
+
+// NewTemplateFormat returns a Formatter which writes entries using template
+// containing placeholders:
+//
+//	%{time}         request time in Common Log Format
+//	%{remote_addr}  client address
+//	%{method}       request method
+//	%{uri}          request URI
+//	%{path}         request path
+//	%{proto}        request protocol
+//	%{status}       response status code
+//	%{size}         response size in bytes
+//	%{latency}      latency in the unit set by WithLatencyUnit
+//	%{latency_ms}   latency in milliseconds
+//	%{latency_us}   latency in microseconds
+//	%{request_id}   request ID
+//	%{principal}    authenticated user
+//	%{route}        matched route template, e.g. /users/{id}
+//	%{timed_out}    true if the request timed out, false otherwise
+//	%{header:Name}  request header
+//
+// A new line is appended to each entry.
+func NewTemplateFormat(template string, options ...FormatOption) (Formatter, error) {
+	f := &templateFormat{
+		formatOptions: newFormatOptions(options),
+	}
+	for {
+		i := strings.Index(template, "%{")
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(template[i:], '}')
+		if j < 0 {
+			return nil, fmt.Errorf("melon/logging: unclosed placeholder in template %q", template)
+		}
+		if i > 0 {
+			f.addLiteral(template[:i])
+		}
+		name := template[i+2 : i+j]
+		part := f.placeholder(name)
+		if part == nil {
+			return nil, fmt.Errorf("melon/logging: unsupported placeholder %q", name)
+		}
+		f.parts = append(f.parts, part)
+		template = template[i+j+1:]
+	}
+	f.addLiteral(template + "\n")
+	return f, nil
+}
+
+func (f *templateFormat) addLiteral(s string) {
+	f.parts = append(f.parts, func(buf *bytes.Buffer, e *Entry) {
+		buf.WriteString(s)
+	})
+}
+
+func (f *templateFormat) placeholder(name string) func(buf *bytes.Buffer, e *Entry) {
+	if strings.HasPrefix(name, "header:") {
+		header := http.CanonicalHeaderKey(name[len("header:"):])
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(orDash(e.Request.Header.Get(header)))
+		}
+	}
+	switch name {
+	case "time":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(f.time(e.Time).Format(clfTimeFormat))
+		}
+	case "remote_addr":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(getRemoteAddr(e.Request))
+		}
+	case "method":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(e.Request.Method)
+		}
+	case "uri":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(e.Request.RequestURI)
+		}
+	case "path":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(e.Request.URL.Path)
+		}
+	case "proto":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(e.Request.Proto)
+		}
+	case "status":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(strconv.Itoa(e.Status))
+		}
+	case "size":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(strconv.FormatUint(e.Size, 10))
+		}
+	case "latency":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(strconv.FormatInt(f.latency(e.Latency), 10))
+		}
+	case "latency_ms":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(strconv.FormatInt(int64(e.Latency/time.Millisecond), 10))
+		}
+	case "latency_us":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(strconv.FormatInt(int64(e.Latency/time.Microsecond), 10))
+		}
+	case "request_id":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(orDash(e.RequestID))
+		}
+	case "principal":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(orDash(e.Principal))
+		}
+	case "route":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(orDash(e.Route))
+		}
+	case "timed_out":
+		return func(buf *bytes.Buffer, e *Entry) {
+			buf.WriteString(strconv.FormatBool(e.TimedOut))
+		}
+	}
+	return nil
+}
+
+func (f *templateFormat) Format(buf *bytes.Buffer, e *Entry) {
+	for _, part := range f.parts {
+		part(buf, e)
+	}
+}
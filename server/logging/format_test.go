@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/server/filter"
+)
+
+func newEntry() *Entry {
+	r := httptest.NewRequest("GET", "/path?q=1", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("User-Agent", "melon/1.0")
+	r.Header.Set("X-Foo", "bar")
+	return &Entry{
+		Request:   r,
+		Time:      today,
+		Latency:   1500 * time.Microsecond,
+		Status:    http.StatusCreated,
+		Size:      10,
+		RequestID: "id1",
+		Principal: "user",
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tpl, err := NewTemplateFormat(`%{method} %{path} %{status} %{latency_ms}ms %{latency_us}us %{header:x-foo} %{header:X-Bar} %{principal} %{request_id}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		formatter Formatter
+		expected  string
+	}{
+		{NewCommonFormat(), `192.0.2.1 - user [14/Jan/2015:01:02:03 +0700] "GET /path?q=1 HTTP/1.1" 201 10 "-" "melon/1.0" 1 "id1"` + "\n"},
+		{NewCommonFormat(WithLocation(time.UTC), WithLatencyUnit(time.Microsecond)), `192.0.2.1 - user [13/Jan/2015:18:02:03 +0000] "GET /path?q=1 HTTP/1.1" 201 10 "-" "melon/1.0" 1500 "id1"` + "\n"},
+		{NewCombinedFormat(), `192.0.2.1 - user [14/Jan/2015:01:02:03 +0700] "GET /path?q=1 HTTP/1.1" 201 10 "-" "melon/1.0"` + "\n"},
+		{NewJSONFormat(WithLocation(time.UTC)), `{"time":"2015-01-13T18:02:03.789Z","remote_addr":"192.0.2.1","method":"GET","uri":"/path?q=1","proto":"HTTP/1.1","status":201,"size":10,"user_agent":"melon/1.0","latency_ms":1,"request_id":"id1","principal":"user"}` + "\n"},
+		{NewJSONFormat(WithLatencyUnit(time.Microsecond)), `{"time":"2015-01-14T01:02:03.789+07:00","remote_addr":"192.0.2.1","method":"GET","uri":"/path?q=1","proto":"HTTP/1.1","status":201,"size":10,"user_agent":"melon/1.0","latency_us":1500,"request_id":"id1","principal":"user"}` + "\n"},
+		{tpl, "GET /path 201 1ms 1500us bar - user id1\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		test.formatter.Format(&buf, newEntry())
+		if test.expected != buf.String() {
+			t.Fatalf("unexpected log %T:\n%s\n%s", test.formatter, test.expected, buf.String())
+		}
+	}
+}
+
+func TestTemplateFormatError(t *testing.T) {
+	templates := []string{
+		"%{method",
+		"%{unknown}",
+	}
+	for _, tpl := range templates {
+		if _, err := NewTemplateFormat(tpl); err == nil {
+			t.Fatalf("error expected for %s", tpl)
+		}
+	}
+}
+
+func TestSetPrincipal(t *testing.T) {
+	var buf bytes.Buffer
+	formatter, err := NewTemplateFormat("%{principal}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := filter.NewChain()
+	chain.Add(NewFilter(&buf, WithFormatter(formatter)))
+	chain.Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetPrincipal(r, "admin")
+	}))
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if "admin\n" != buf.String() {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+}
@@ -5,73 +5,241 @@ package logging
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/goburrow/gol"
 	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/requestid"
 )
 
 const (
-	timeFormat = "02/Jan/2006:15:04:05 -0700"
-
 	xRequestID    = "X-Request-Id"
 	xForwardedFor = "X-Forwarded-For"
 )
 
 // For testing
-var now = time.Now
+var (
+	now    = time.Now
+	random = rand.Float64
+)
+
+// Entry is a record of a request in the request log.
+type Entry struct {
+	Request *http.Request
+	// Time is when the request was received.
+	Time    time.Time
+	Latency time.Duration
+	Status  int
+	Size    uint64
+
+	RequestID string
+	// Principal is the name of authenticated user, set by SetPrincipal.
+	Principal string
+	// Route is the matched route template, e.g. /users/{id}, and
+	// HandlerLatency is the time spent in its handler. They are set by
+	// the router.
+	Route          string
+	HandlerLatency time.Duration
+	// TimedOut is set by the timeout filter when the request was not served
+	// in time.
+	TimedOut bool
+}
+
+// Level returns gol.Error for server errors, gol.Warn for client errors
+// and gol.Info for other responses.
+func (e *Entry) Level() gol.Level {
+	switch {
+	case e.Status >= 500:
+		return gol.Error
+	case e.Status >= 400:
+		return gol.Warn
+	default:
+		return gol.Info
+	}
+}
+
+// LevelWriter is a writer which also receives level of each entry,
+// so that it can filter entries by level.
+type LevelWriter interface {
+	WriteLevel(level gol.Level, p []byte) (int, error)
+}
 
-// logFilter is a middleware which logs all requests in Common Log Format.
+// logFilter is a middleware which logs all requests.
 type logFilter struct {
-	writer io.Writer
+	writer    io.Writer
+	formatter Formatter
+
+	excludedPaths map[string]struct{}
+	sampleRate    float64
+}
+
+// Option is a Filter option.
+type Option func(f *logFilter)
+
+// NewFilter returns a new Filter logging all HTTP requests to given writer.
+// Requests are logged in Common Log Format unless WithFormatter is used.
+func NewFilter(writer io.Writer, options ...Option) filter.Filter {
+	f := &logFilter{
+		writer:    writer,
+		formatter: NewCommonFormat(),
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	return f
+}
+
+// WithFormatter sets format of the request log.
+func WithFormatter(formatter Formatter) Option {
+	return func(f *logFilter) {
+		f.formatter = formatter
+	}
+}
+
+// WithExcludedPaths disables logging requests of the given paths,
+// e.g. /ping.
+func WithExcludedPaths(paths ...string) Option {
+	return func(f *logFilter) {
+		if f.excludedPaths == nil {
+			f.excludedPaths = make(map[string]struct{}, len(paths))
+		}
+		for _, p := range paths {
+			f.excludedPaths[p] = struct{}{}
+		}
+	}
+}
+
+// WithSampleRate only logs the given fraction, between 0 and 1, of successful
+// requests. Requests with status code 400 or greater are always logged.
+// Zero rate logs all requests.
+func WithSampleRate(rate float64) Option {
+	return func(f *logFilter) {
+		f.sampleRate = rate
+	}
 }
 
-// NewFilter returns a new Filter logging all HTTP requests in Common Log Format to given writer.
-func NewFilter(writer io.Writer) filter.Filter {
-	return &logFilter{writer: writer}
+// Priority returns filter.PriorityRequestLog so that the request log is
+// always recorded.
+func (f *logFilter) Priority() int {
+	return filter.PriorityRequestLog
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
 }
 
 func (f *logFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, ok := f.excludedPaths[r.URL.Path]; ok {
+		filter.Continue(w, r)
+		return
+	}
 	responseWriter := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+	entry, req := withEntry(r)
+	entry.Time = now()
+	filter.Continue(responseWriter, req)
+	entry.Latency = now().Sub(entry.Time)
+	entry.Status = responseWriter.status
+	entry.Size = responseWriter.size
+	if f.sampleRate > 0 && entry.Status < http.StatusBadRequest && random() >= f.sampleRate {
+		return
+	}
+	entry.RequestID = requestid.FromRequest(r)
+	if entry.RequestID == "" {
+		entry.RequestID = r.Header.Get(xRequestID)
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	f.formatter.Format(buf, entry)
+	if lw, ok := f.writer.(LevelWriter); ok {
+		lw.WriteLevel(entry.Level(), buf.Bytes())
+	} else {
+		f.writer.Write(buf.Bytes())
+	}
+	bufferPool.Put(buf)
+}
+
+// contextKey is a value for use with context.WithValue
+type contextKey struct {
+	name string
+}
 
-	start := now()
-	filter.Continue(responseWriter, r)
-	end := now()
-
-	remoteAddr := getRemoteAddr(r)
-	referer := r.Referer()
-	if referer == "" {
-		referer = "-"
-	}
-	userAgent := r.UserAgent()
-	if userAgent == "" {
-		userAgent = "-"
-	}
-	startTime := start.Format(timeFormat)
-	responseTime := end.Sub(start).Nanoseconds() / int64(time.Millisecond)
-	requestID := r.Header.Get(xRequestID)
-
-	// Common log format
-	fmt.Fprintf(f.writer, "%s %s %s [%s] \"%s %s %s\" %d %d %q %q %d %q\n",
-		remoteAddr,
-		"-", // Identity is not supported.
-		"-", // UserID is not supported.
-		startTime,
-		r.Method,
-		r.RequestURI,
-		r.Proto,
-		responseWriter.status,
-		responseWriter.size,
-		referer,
-		userAgent,
-		responseTime,
-		requestID,
-	)
+func (c *contextKey) String() string {
+	return "melon/logging context value " + c.name
+}
+
+var entryContextKey = &contextKey{"entry"}
+
+// FromRequest returns the request log entry of the request, or nil if
+// neither request log nor slow request log is enabled. The entry is only
+// complete after the request has been served.
+func FromRequest(r *http.Request) *Entry {
+	if entry, ok := r.Context().Value(entryContextKey).(*Entry); ok {
+		return entry
+	}
+	return nil
+}
+
+// SetPrincipal records name of the authenticated user of the request to
+// the request log. It is called by authentication filters which are executed
+// after the request log filter.
+func SetPrincipal(r *http.Request, name string) {
+	if entry := FromRequest(r); entry != nil {
+		entry.Principal = name
+	}
+}
+
+// Detach returns a shallow copy of r with a copy of its request log entry,
+// so that the rest of the filter chain can be executed in another goroutine
+// without racing with the request log filter. Attach copies the entry back
+// after the goroutine has finished.
+func Detach(r *http.Request) *http.Request {
+	entry := FromRequest(r)
+	if entry == nil {
+		return r
+	}
+	detached := *entry
+	return r.WithContext(context.WithValue(r.Context(), entryContextKey, &detached))
+}
+
+// Attach copies the request log entry of the detached request, which is
+// returned by Detach, to the entry of r.
+func Attach(r, detached *http.Request) {
+	entry := FromRequest(r)
+	if entry == nil {
+		return
+	}
+	if e := FromRequest(detached); e != nil && e != entry {
+		*entry = *e
+	}
+}
+
+// SetTimedOut marks the request as timed out in the request log.
+func SetTimedOut(r *http.Request) {
+	if entry := FromRequest(r); entry != nil {
+		entry.TimedOut = true
+	}
+}
+
+// withEntry returns the entry attached to the request, or attaches a new one
+// so that it is shared between request log filters.
+func withEntry(r *http.Request) (*Entry, *http.Request) {
+	if entry := FromRequest(r); entry != nil {
+		return entry, r
+	}
+	entry := &Entry{Request: r}
+	return entry, r.WithContext(context.WithValue(r.Context(), entryContextKey, entry))
 }
 
 func getRemoteAddr(r *http.Request) string {
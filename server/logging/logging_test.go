@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/requestid"
 )
 
 var today = time.Date(2015, time.January, 14, 1, 2, 3, 789000000, time.FixedZone("Asia/Ho_Chi_Minh", 7*60*60))
@@ -97,3 +98,56 @@ func TestResponseError(t *testing.T) {
 		t.Fatalf("unexpected access log %v", buf.String())
 	}
 }
+
+func TestRequestID(t *testing.T) {
+	var buf bytes.Buffer
+
+	chain := filter.NewChain()
+	chain.Add(requestid.NewFilter(requestid.WithGenerator(func() string { return "id1" })))
+	chain.Add(NewFilter(&buf))
+	chain.Add(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	chain.ServeHTTP(w, r)
+	expected := `127.0.0.1 - - [14/Jan/2015:01:02:03 +0700] "GET / HTTP/1.1" 200 0 "-" "-" 0 "id1"` + "\n"
+	if expected != buf.String() {
+		t.Fatalf("unexpected access log %v", buf.String())
+	}
+}
+
+func TestExcludedPaths(t *testing.T) {
+	var buf bytes.Buffer
+	chain := filter.NewChain()
+	chain.Add(NewFilter(&buf, WithExcludedPaths("/ping", "/healthcheck")))
+	chain.Add(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for _, path := range []string{"/ping", "/healthcheck", "/ping/1"} {
+		chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	if 1 != bytes.Count(buf.Bytes(), []byte("\n")) || !bytes.Contains(buf.Bytes(), []byte("/ping/1")) {
+		t.Fatalf("unexpected access log %v", buf.String())
+	}
+}
+
+func TestSampleRate(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(r func() float64) { random = r }(random)
+	random = func() float64 { return 0.5 }
+
+	chain := filter.NewChain()
+	chain.Add(NewFilter(&buf, WithSampleRate(0.1)))
+	chain.Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	for i := 0; i < 10; i++ {
+		chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/error", nil))
+	if !bytes.HasPrefix(buf.Bytes(), []byte("192.0.2.1 - - [14/Jan/2015:01:02:03 +0700] \"GET /error")) {
+		t.Fatalf("unexpected access log %v", buf.String())
+	}
+}
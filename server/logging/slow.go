@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/requestid"
+)
+
+// slowFilter logs requests which take longer than the threshold.
+type slowFilter struct {
+	threshold time.Duration
+	logger    core.Logger
+}
+
+// NewSlowFilter returns a new Filter logging requests which take longer than
+// threshold to logger at WARN level. Each record contains method, route
+// template, principal and time spent in the route handler and in the filters.
+func NewSlowFilter(threshold time.Duration, logger core.Logger) filter.Filter {
+	return &slowFilter{
+		threshold: threshold,
+		logger:    logger,
+	}
+}
+
+// Priority returns filter.PriorityRequestLog so that time spent in other
+// filters is also measured.
+func (f *slowFilter) Priority() int {
+	return filter.PriorityRequestLog
+}
+
+func (f *slowFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	responseWriter := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+	entry, req := withEntry(r)
+	start := now()
+	filter.Continue(responseWriter, req)
+	latency := now().Sub(start)
+	if latency < f.threshold {
+		return
+	}
+	f.logger.Warnf("slow request %s %s (%s) status=%d principal=%s id=%s total=%v handler=%v filters=%v",
+		r.Method, orDash(entry.Route), r.URL.Path, responseWriter.status,
+		orDash(entry.Principal), orDash(requestid.FromRequest(r)),
+		latency, entry.HandlerLatency, latency-entry.HandlerLatency)
+}
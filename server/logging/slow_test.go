@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/server/filter"
+)
+
+type testLogger struct {
+	warns []string
+}
+
+func (l *testLogger) Debugf(format string, args ...interface{}) {}
+func (l *testLogger) Infof(format string, args ...interface{})  {}
+func (l *testLogger) Errorf(format string, args ...interface{}) {}
+
+func (l *testLogger) Warnf(format string, args ...interface{}) {
+	l.warns = append(l.warns, fmt.Sprintf(format, args...))
+}
+
+func TestSlowFilter(t *testing.T) {
+	defer func(f func() time.Time) {
+		now = f
+	}(now)
+	var latency time.Duration
+	now = func() time.Time {
+		t := today.Add(latency)
+		latency += 2 * time.Second
+		return t
+	}
+	logger := &testLogger{}
+	chain := filter.NewChain()
+	chain.Add(NewSlowFilter(time.Second, logger))
+	chain.Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := FromRequest(r)
+		if entry == nil {
+			t.Fatal("entry must be set")
+		}
+		entry.Route = "/users/{id}"
+		entry.HandlerLatency = 1500 * time.Millisecond
+		SetPrincipal(r, "alice")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	r := httptest.NewRequest("POST", "/users/1", nil)
+	chain.ServeHTTP(httptest.NewRecorder(), r)
+	if len(logger.warns) != 1 {
+		t.Fatalf("unexpected logs: %#v", logger.warns)
+	}
+	expected := "slow request POST /users/{id} (/users/1) status=201 principal=alice id=- total=2s handler=1.5s filters=500ms"
+	if expected != logger.warns[0] {
+		t.Fatalf("unexpected log:\n%s\nwant:\n%s", logger.warns[0], expected)
+	}
+	// Fast request
+	logger.warns = nil
+	chain = filter.NewChain()
+	chain.Add(NewSlowFilter(3*time.Second, logger))
+	chain.ServeHTTP(httptest.NewRecorder(), r)
+	if len(logger.warns) != 0 {
+		t.Fatalf("unexpected logs: %#v", logger.warns)
+	}
+}
+
+func TestSlowFilterSharedEntry(t *testing.T) {
+	logger := &testLogger{}
+	chain := filter.NewChain()
+	chain.Add(NewFilter(&nopWriter{}))
+	chain.Add(NewSlowFilter(0, logger))
+	chain.Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromRequest(r).Route = "/"
+	}))
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	expected := "slow request GET / (/) status=200 principal=- id=- total=0s handler=0s filters=0s"
+	if len(logger.warns) != 1 || logger.warns[0] != expected {
+		t.Fatalf("unexpected logs: %#v", logger.warns)
+	}
+}
+
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
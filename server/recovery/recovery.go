@@ -4,54 +4,223 @@ Package recovery provides a filter which can recover panics.
 package recovery
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net"
 	"net/http"
-	"runtime"
+	"runtime/debug"
 
 	"github.com/codahale/metrics"
 	"github.com/goburrow/melon/core"
 	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/requestid"
 )
 
-const (
-	stackSkip = 4
-	stackMax  = 50
-)
+// ErrorMapper writes errors to HTTP responses. It is implemented by
+// views.ErrorMapper.
+type ErrorMapper interface {
+	MapError(http.ResponseWriter, *http.Request, error)
+}
+
+// PanicError is the error given to ErrorMapper when the handler panics.
+// The panic has already been logged.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the goroutine which panicked.
+	Stack []byte
+	// ID is the request ID or a random ID, which is also logged.
+	ID string
+}
+
+// Error returns the panic message.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
 
 // recoveryFilter handles panics.
 type recoveryFilter struct {
-	panics metrics.Counter
+	panics   metrics.Counter
+	timeouts metrics.Counter
+
+	repanicAbort bool
+	reporter     core.ErrorReporter
 }
 
+// Option is a Filter option.
+type Option func(f *recoveryFilter)
+
 // NewFilter returns a Filter whichs recovers and logs panics from HTTP handler.
-func NewFilter() filter.Filter {
-	return &recoveryFilter{
-		panics: metrics.Counter("HTTP.Panics"),
+// The error response is written by the ErrorMapper set by SetErrorMapper,
+// or in plain text otherwise.
+func NewFilter(options ...Option) filter.Filter {
+	f := &recoveryFilter{
+		panics:   metrics.Counter("HTTP.Panics"),
+		timeouts: metrics.Counter("HTTP.Timeouts"),
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	return f
+}
+
+// WithRepanicAbort re-panics http.ErrAbortHandler so that the HTTP server
+// aborts the response without logging. By default, it is recovered as other
+// panics.
+func WithRepanicAbort() Option {
+	return func(f *recoveryFilter) {
+		f.repanicAbort = true
+	}
+}
+
+// WithErrorReporter sends recovered panics to reporter, e.g.
+// core.Environment.Errors.
+func WithErrorReporter(reporter core.ErrorReporter) Option {
+	return func(f *recoveryFilter) {
+		f.reporter = reporter
 	}
 }
 
+// Priority returns filter.PriorityRecovery.
+func (f *recoveryFilter) Priority() int {
+	return filter.PriorityRecovery
+}
+
 func (f *recoveryFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s := &state{}
+	rw := &responseWriter{ResponseWriter: w}
 	defer func() {
 		if err := recover(); err != nil {
-			f.panics.Add()
-			core.GetLogger("melon/server").Errorf("%v\n%s", err, stack())
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			f.recover(rw, r, s, err)
 		}
 	}()
-	filter.Continue(w, r)
+	filter.Continue(rw, r.WithContext(context.WithValue(r.Context(), stateContextKey, s)))
 }
 
-func stack() []byte {
-	var buf bytes.Buffer
-
-	for i := stackSkip; i < stackMax; i++ {
-		pc, file, line, ok := runtime.Caller(i)
-		if !ok {
-			break
+func (f *recoveryFilter) recover(w *responseWriter, r *http.Request, s *state, err interface{}) {
+	if err == http.ErrAbortHandler && f.repanicAbort {
+		panic(err)
+	}
+	logger := core.GetLogger("melon/server")
+	if isTimeout(r, err) {
+		// Handler may panic because its operations are cancelled.
+		f.timeouts.Add()
+		logger.Warnf("request timed out %s %s: %v", r.Method, r.URL.Path, err)
+		if !w.wroteHeader {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 		}
-		f := runtime.FuncForPC(pc)
-		fmt.Fprintf(&buf, "! %s:%d %s()\n", file, line, f.Name())
+		return
+	}
+	f.panics.Add()
+	e := &PanicError{
+		Value: err,
+		Stack: debug.Stack(),
+		ID:    requestid.FromRequest(r),
+	}
+	if e.ID == "" {
+		e.ID = fmt.Sprintf("%016x", rand.Int63())
+	}
+	if f.reporter != nil {
+		f.reporter.ReportError(&core.ErrorReport{
+			Source:    "server",
+			Err:       e,
+			Stack:     e.Stack,
+			Request:   r,
+			RequestID: e.ID,
+		})
+	}
+	if w.wroteHeader {
+		// Response can not be changed, it is likely incomplete.
+		logger.Errorf("panic serving %s %s (ID %s) after response headers were written: %v\n%s",
+			r.Method, r.URL.Path, e.ID, err, e.Stack)
+		return
+	}
+	logger.Errorf("panic serving %s %s (ID %s): %v\n%s", r.Method, r.URL.Path, e.ID, err, e.Stack)
+	if s.mapper != nil {
+		s.mapper.MapError(w, s.request, e)
+		return
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// isTimeout checks if the handler panicked with a timeout error after the
+// request timed out. Other panics are bugs even when the request has timed
+// out, so they are logged with stack traces.
+func isTimeout(r *http.Request, err interface{}) bool {
+	if r.Context().Err() != context.DeadlineExceeded {
+		return false
+	}
+	return err == context.DeadlineExceeded || err == http.ErrHandlerTimeout
+}
+
+// contextKey is a value for use with context.WithValue
+type contextKey struct {
+	name string
+}
+
+func (c *contextKey) String() string {
+	return "melon/recovery context value " + c.name
+}
+
+var stateContextKey = &contextKey{"state"}
+
+// state is attached to the request context by the filter.
+type state struct {
+	mapper  ErrorMapper
+	request *http.Request
+}
+
+// SetErrorMapper sets mapper to write the error response when handling
+// request r panics. The mapper is given r, which may carry additional context
+// values, e.g. negotiated content type. It is called by handlers which
+// execute after the recovery filter.
+func SetErrorMapper(r *http.Request, mapper ErrorMapper) {
+	if s, ok := r.Context().Value(stateContextKey).(*state); ok {
+		s.mapper = mapper
+		s.request = r
+	}
+}
+
+// responseWriter records whether response headers have been written.
+type responseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush implements http.Flusher.
+func (w *responseWriter) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		fl.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		w.wroteHeader = true
+		return hj.Hijack()
+	}
+	return nil, nil, errors.New("not a Hijacker")
+}
+
+// CloseNotifiy implements http.CloseNotifier.
+func (w *responseWriter) CloseNotify() <-chan bool {
+	if cn, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
 	}
-	return buf.Bytes()
+	panic("not a CloseNotifier")
 }
@@ -1,10 +1,12 @@
 package recovery
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/goburrow/melon/core"
 	"github.com/goburrow/melon/server/filter"
@@ -63,3 +65,134 @@ func testFilter(t *testing.T, h http.Handler) {
 		t.Fatalf("unexpected body %v", w.Body.String())
 	}
 }
+
+type testErrorMapper struct {
+	err error
+	r   *http.Request
+}
+
+func (m *testErrorMapper) MapError(w http.ResponseWriter, r *http.Request, err error) {
+	m.err = err
+	m.r = r
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte(err.(*PanicError).ID))
+}
+
+func TestErrorMapper(t *testing.T) {
+	mapper := &testErrorMapper{}
+	var request *http.Request
+	h := func(w http.ResponseWriter, r *http.Request) {
+		request = r.WithContext(r.Context())
+		SetErrorMapper(request, mapper)
+		panic("mapped")
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	chain := filter.NewChain()
+	chain.Add(NewFilter(), http.HandlerFunc(h))
+	chain.ServeHTTP(w, r)
+	err, ok := mapper.err.(*PanicError)
+	if !ok || err.Value != "mapped" || len(err.Stack) == 0 || err.ID == "" {
+		t.Fatalf("unexpected error: %#v", mapper.err)
+	}
+	if mapper.r != request {
+		t.Fatalf("unexpected request: %v", mapper.r)
+	}
+	if w.Code != 500 || w.Body.String() != err.ID {
+		t.Fatalf("unexpected response: %v %v", w.Code, w.Body.String())
+	}
+}
+
+type testErrorReporter struct {
+	reports []*core.ErrorReport
+}
+
+func (r *testErrorReporter) ReportError(report *core.ErrorReport) {
+	r.reports = append(r.reports, report)
+}
+
+func TestErrorReporter(t *testing.T) {
+	reporter := &testErrorReporter{}
+	h := func(w http.ResponseWriter, r *http.Request) {
+		panic("reported")
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	chain := filter.NewChain()
+	chain.Add(NewFilter(WithErrorReporter(reporter)), http.HandlerFunc(h))
+	chain.ServeHTTP(w, r)
+	if len(reporter.reports) != 1 {
+		t.Fatalf("unexpected reports: %+v", reporter.reports)
+	}
+	report := reporter.reports[0]
+	if report.Source != "server" || report.Err.Error() != "panic: reported" || report.RequestID == "" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestPanicAfterTimeout(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		reported bool
+	}{
+		{context.DeadlineExceeded, false},
+		{http.ErrHandlerTimeout, false},
+		{"bug", true},
+	}
+	for _, test := range tests {
+		reporter := &testErrorReporter{}
+		h := func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			panic(test.value)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		chain := filter.NewChain()
+		chain.Add(NewFilter(WithErrorReporter(reporter)), http.HandlerFunc(h))
+		chain.ServeHTTP(w, r)
+		cancel()
+		if test.reported != (len(reporter.reports) == 1) {
+			t.Errorf("unexpected reports of panic %v: %+v", test.value, reporter.reports)
+		}
+		status := http.StatusServiceUnavailable
+		if test.reported {
+			status = http.StatusInternalServerError
+		}
+		if w.Code != status {
+			t.Errorf("unexpected response of panic %v: %v", test.value, w.Code)
+		}
+	}
+}
+
+func TestPanicAfterWrite(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("panic")
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	chain := filter.NewChain()
+	chain.Add(NewFilter(), http.HandlerFunc(h))
+	chain.ServeHTTP(w, r)
+	if w.Code != 200 || w.Body.String() != "partial" {
+		t.Fatalf("unexpected response: %v %v", w.Code, w.Body.String())
+	}
+}
+
+func TestRepanicAbort(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}
+	testFilter(t, http.HandlerFunc(h))
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Fatalf("unexpected panic: %v", err)
+		}
+	}()
+	chain := filter.NewChain()
+	chain.Add(NewFilter(WithRepanicAbort()), http.HandlerFunc(h))
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	t.Fatal("panic expected")
+}
@@ -0,0 +1,171 @@
+/*
+Package requestid provides a filter which assigns an ID to each request.
+*/
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/goburrow/melon/server/filter"
+)
+
+const (
+	// DefaultHeader is the default header of request ID.
+	DefaultHeader = "X-Request-Id"
+
+	maxLength = 128
+)
+
+// requestIDFilter reads request ID from request header or generates a new one.
+type requestIDFilter struct {
+	header   string
+	generate func() string
+}
+
+// Option is a Filter option.
+type Option func(f *requestIDFilter)
+
+// NewFilter returns a Filter which accepts request ID from the request header
+// or generates a new one if not provided. The ID is added to the response
+// header and the request context.
+func NewFilter(options ...Option) filter.Filter {
+	f := &requestIDFilter{
+		header:   DefaultHeader,
+		generate: NewUUID,
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	return f
+}
+
+// Priority returns filter.PriorityRequestID, so the request ID is available
+// in the request log.
+func (f *requestIDFilter) Priority() int {
+	return filter.PriorityRequestID
+}
+
+func (f *requestIDFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(f.header)
+	if !isValid(id) {
+		id = f.generate()
+	}
+	w.Header().Set(f.header, id)
+	filter.Continue(w, r.WithContext(NewContext(r.Context(), id)))
+}
+
+// WithHeader sets header name of request ID.
+func WithHeader(name string) Option {
+	return func(f *requestIDFilter) {
+		f.header = http.CanonicalHeaderKey(name)
+	}
+}
+
+// WithGenerator sets function to generate request ID.
+func WithGenerator(generate func() string) Option {
+	return func(f *requestIDFilter) {
+		f.generate = generate
+	}
+}
+
+// isValid only accepts printable ASCII IDs so they can be logged safely.
+func isValid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// contextKey is a value for use with context.WithValue
+type contextKey struct {
+	name string
+}
+
+func (c *contextKey) String() string {
+	return "melon/requestid context value " + c.name
+}
+
+var requestIDContextKey = &contextKey{"requestid"}
+
+// NewContext returns a new Context carrying request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// FromContext returns request ID stored in ctx or empty if not found.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDContextKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// FromRequest returns request ID of the request or empty if not found.
+func FromRequest(r *http.Request) string {
+	return FromContext(r.Context())
+}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() string {
+	var b [16]byte
+	random(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
+
+// crockford is the Crockford's Base32 alphabet used by ULID.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a Universally Unique Lexicographically Sortable Identifier
+// of the current time.
+func NewULID() string {
+	return newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	// 48 bits timestamp in milliseconds and 80 bits randomness.
+	var b [16]byte
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint64(b[:8], ms<<16)
+	random(b[6:])
+
+	// 128 bits are encoded to 26 characters, 5 bits each with the first
+	// character having only 3 bits.
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var buf [26]byte
+	for i := 25; i >= 0; i-- {
+		buf[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
+
+func random(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic("melon/requestid: could not read random bytes: " + err.Error())
+	}
+}
@@ -0,0 +1,68 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/server/filter"
+)
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	ulidPattern = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+)
+
+func serve(f filter.Filter, r *http.Request) (*httptest.ResponseRecorder, string) {
+	var id string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id = FromRequest(r)
+	}
+	chain := filter.NewChain()
+	chain.Add(f, http.HandlerFunc(handler))
+	w := httptest.NewRecorder()
+	chain.ServeHTTP(w, r)
+	return w, id
+}
+
+func TestGenerateID(t *testing.T) {
+	w, id := serve(NewFilter(), httptest.NewRequest("GET", "/", nil))
+	if !uuidPattern.MatchString(id) {
+		t.Fatalf("unexpected request id: %v", id)
+	}
+	if id != w.Header().Get("X-Request-Id") {
+		t.Fatalf("unexpected header: %v", w.Header())
+	}
+}
+
+func TestAcceptID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Trace-Id", "abc-123")
+	w, id := serve(NewFilter(WithHeader("x-trace-id")), r)
+	if "abc-123" != id {
+		t.Fatalf("unexpected request id: %v", id)
+	}
+	if id != w.Header().Get("X-Trace-Id") {
+		t.Fatalf("unexpected header: %v", w.Header())
+	}
+	// Invalid ID
+	r.Header.Set("X-Trace-Id", "abc\n123")
+	_, id = serve(NewFilter(WithHeader("x-trace-id"), WithGenerator(NewULID)), r)
+	if !ulidPattern.MatchString(id) {
+		t.Fatalf("unexpected request id: %v", id)
+	}
+}
+
+func TestULID(t *testing.T) {
+	tm := time.Unix(1469918176, 385000000)
+	id := newULID(tm)
+	// Timestamp 1469918176385 is encoded to 01ARYZ6S41.
+	if !ulidPattern.MatchString(id) || "01ARYZ6S41" != id[:10] {
+		t.Fatalf("unexpected ULID: %v", id)
+	}
+	if newULID(tm.Add(time.Millisecond)) <= id {
+		t.Fatal("ULID is not sortable")
+	}
+}
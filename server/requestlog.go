@@ -0,0 +1,263 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goburrow/gol"
+	"github.com/goburrow/gol/file/rotation"
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/logging"
+	"github.com/goburrow/melon/server/filter"
+	slogging "github.com/goburrow/melon/server/logging"
+)
+
+// RequestLogAppenderFactory builds a writer for the request log. Besides
+// console, file and syslog appenders, appender types registered with
+// dynamic.Register which implement this interface can be used in
+// RequestLogConfiguration. The writer can implement slogging.LevelWriter to
+// receive level of each entry and should be added to env.Lifecycle if it
+// needs to be closed.
+type RequestLogAppenderFactory interface {
+	BuildRequestLog(env *core.Environment) (io.Writer, error)
+}
+
+// RequestLogConfiguration is the configuration for the server request log.
+// It utilized the configuration of logging appenders. Threshold of appenders
+// applies to levels of entries, which are ERROR for server errors, WARN for
+// client errors and INFO for others.
+// Format is either "common" (default), "combined", "json" or a template with
+// placeholders such as %{method} and %{status} (see logging.NewTemplateFormat).
+// TimeZone is a location name, e.g. "UTC", default to local time zone.
+// LatencyUnit is either "ms" (default) or "us".
+// When Async is enabled, entries are written in background with a queue of
+// QueueSize (default 1024) entries and dropped when the queue is full.
+// ExcludedPaths are request paths not to be logged, e.g. /ping.
+// SampleRate is the fraction of successful requests to be logged, zero
+// logs all requests.
+type RequestLogConfiguration struct {
+	Appenders   []logging.AppenderConfiguration
+	Format      string
+	TimeZone    string
+	LatencyUnit string
+
+	Async         bool
+	QueueSize     int
+	ExcludedPaths []string
+	SampleRate    float64
+}
+
+// Build returns nil Filter if no appenders are set.
+func (f *RequestLogConfiguration) Build(env *core.Environment) (filter.Filter, error) {
+	if f.SampleRate < 0 || f.SampleRate > 1 {
+		return nil, fmt.Errorf("server: invalid request log sample rate %v", f.SampleRate)
+	}
+	if len(f.Appenders) == 0 {
+		// No request log
+		return nil, nil
+	}
+	formatter, err := f.buildFormatter()
+	if err != nil {
+		return nil, err
+	}
+	writer := &requestLogWriter{}
+	for _, appender := range f.Appenders {
+		a, err := buildRequestLogAppender(env, appender.Value())
+		if err != nil {
+			return nil, err
+		}
+		writer.appenders = append(writer.appenders, a)
+	}
+	var w io.Writer = writer
+	if f.Async {
+		// Stopped before appenders so that remaining entries are written.
+		asyncWriter := slogging.NewAsyncWriter(w, f.QueueSize)
+		env.Lifecycle.Manage(asyncWriter)
+		w = asyncWriter
+	}
+	options := []slogging.Option{
+		slogging.WithFormatter(formatter),
+		slogging.WithSampleRate(f.SampleRate),
+	}
+	if len(f.ExcludedPaths) > 0 {
+		options = append(options, slogging.WithExcludedPaths(f.ExcludedPaths...))
+	}
+	return slogging.NewFilter(w, options...), nil
+}
+
+func (f *RequestLogConfiguration) buildFormatter() (slogging.Formatter, error) {
+	var options []slogging.FormatOption
+	if f.TimeZone != "" {
+		loc, err := time.LoadLocation(f.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("server: invalid request log time zone %v: %v", f.TimeZone, err)
+		}
+		options = append(options, slogging.WithLocation(loc))
+	}
+	switch f.LatencyUnit {
+	case "", "ms":
+	case "us":
+		options = append(options, slogging.WithLatencyUnit(time.Microsecond))
+	default:
+		return nil, fmt.Errorf("server: unsupported request log latency unit %v", f.LatencyUnit)
+	}
+	switch f.Format {
+	case "", "common":
+		return slogging.NewCommonFormat(options...), nil
+	case "combined":
+		return slogging.NewCombinedFormat(options...), nil
+	case "json":
+		return slogging.NewJSONFormat(options...), nil
+	}
+	if !strings.Contains(f.Format, "%{") {
+		return nil, fmt.Errorf("server: unsupported request log format %v", f.Format)
+	}
+	return slogging.NewTemplateFormat(f.Format, options...)
+}
+
+// SlowRequestLogConfiguration is the configuration for logging requests which
+// take longer than Threshold, e.g. "2s", to the logger "melon/server/slow".
+// It is disabled when Threshold is not set.
+type SlowRequestLogConfiguration struct {
+	Threshold string
+}
+
+// Build returns nil Filter if threshold is not set.
+func (f *SlowRequestLogConfiguration) Build() (filter.Filter, error) {
+	if f.Threshold == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(f.Threshold)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("server: invalid slow request log threshold %v", f.Threshold)
+	}
+	return slogging.NewSlowFilter(d, core.GetLogger("melon/server/slow")), nil
+}
+
+// requestLogAppender is a writer of the request log with a threshold.
+type requestLogAppender struct {
+	writer    io.Writer
+	threshold gol.Level
+}
+
+func buildRequestLogAppender(env *core.Environment, v interface{}) (requestLogAppender, error) {
+	var a requestLogAppender
+	var err error
+	switch factory := v.(type) {
+	case *logging.ConsoleAppenderFactory:
+		a.threshold, err = requestLogThreshold(factory.Threshold, factory.Includes, factory.Excludes)
+		if err == nil {
+			a.writer, err = buildConsoleWriter(factory)
+		}
+	case *logging.FileAppenderFactory:
+		a.threshold, err = requestLogThreshold(factory.Threshold, factory.Includes, factory.Excludes)
+		if err == nil {
+			a.writer, err = buildFileWriter(env, factory)
+		}
+	case *logging.SyslogAppenderFactory:
+		a.threshold, err = requestLogThreshold(factory.Threshold, factory.Includes, factory.Excludes)
+		if err == nil {
+			a.writer, err = buildSyslogWriter(env, factory)
+		}
+	case RequestLogAppenderFactory:
+		a.threshold = gol.All
+		a.writer, err = factory.BuildRequestLog(env)
+	default:
+		err = fmt.Errorf("server: unsupported request log appender %#v", v)
+	}
+	return a, err
+}
+
+// requestLogThreshold returns threshold of a request log appender.
+// Includes and excludes are not supported as all entries have the same logger.
+func requestLogThreshold(threshold string, includes, excludes []string) (gol.Level, error) {
+	if len(includes) > 0 || len(excludes) > 0 {
+		return 0, fmt.Errorf("server: request log appender does not support includes and excludes")
+	}
+	return logging.ParseThreshold(threshold)
+}
+
+// requestLogWriter writes entries to all appenders which thresholds are met.
+// Writes from multiple requests are serialized.
+type requestLogWriter struct {
+	mu        sync.Mutex
+	appenders []requestLogAppender
+}
+
+func (w *requestLogWriter) Write(p []byte) (int, error) {
+	return w.WriteLevel(gol.Info, p)
+}
+
+func (w *requestLogWriter) WriteLevel(level gol.Level, p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, a := range w.appenders {
+		if level < a.threshold {
+			continue
+		}
+		if lw, ok := a.writer.(slogging.LevelWriter); ok {
+			lw.WriteLevel(level, p)
+		} else {
+			a.writer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func buildConsoleWriter(config *logging.ConsoleAppenderFactory) (io.Writer, error) {
+	switch config.Target {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		return nil, fmt.Errorf("server: unsupported appender target %v", config.Target)
+	}
+}
+
+func buildFileWriter(env *core.Environment, config *logging.FileAppenderFactory) (io.Writer, error) {
+	writer := &fileWriter{
+		File: rotation.NewFile(config.CurrentLogFilename),
+	}
+	if err := writer.Open(); err != nil {
+		return nil, err
+	}
+	if config.Archive {
+		writer.triggeringPolicy = rotation.NewTimeTriggeringPolicy()
+		if err := writer.triggeringPolicy.Start(); err != nil {
+			writer.Close()
+			return nil, err
+		}
+		rollingPolicy := rotation.NewTimeRollingPolicy()
+		rollingPolicy.FilePattern = config.ArchivedLogFilenamePattern
+		rollingPolicy.FileCount = config.ArchivedFileCount
+
+		writer.SetTriggeringPolicy(writer.triggeringPolicy)
+		writer.SetRollingPolicy(rollingPolicy)
+	}
+	env.Lifecycle.Manage(writer)
+	return writer, nil
+}
+
+// fileWriter is a request log file which is closed when the server stops.
+type fileWriter struct {
+	*rotation.File
+	triggeringPolicy *rotation.TimeTriggeringPolicy
+}
+
+// Start does nothing as the file has been opened.
+func (w *fileWriter) Start() error {
+	return nil
+}
+
+// Stop closes the file.
+func (w *fileWriter) Stop() error {
+	if w.triggeringPolicy != nil {
+		w.triggeringPolicy.Stop()
+	}
+	return w.Close()
+}
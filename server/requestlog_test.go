@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goburrow/gol"
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/logging"
+	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/router"
+)
+
+func TestRequestLogConfiguration(t *testing.T) {
+	appender := logging.AppenderConfiguration{}
+	appender.SetValue(&logging.ConsoleAppenderFactory{})
+
+	config := RequestLogConfiguration{
+		Appenders: []logging.AppenderConfiguration{
+			appender,
+		},
+	}
+
+	env := core.NewEnvironment()
+	filter, err := config.Build(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter == nil {
+		t.Fatalf("unexpected filter %#v", filter)
+	}
+}
+
+func TestNoRequestLogFactory(t *testing.T) {
+	env := core.NewEnvironment()
+	config := RequestLogConfiguration{}
+	filter, err := config.Build(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter != nil {
+		t.Fatalf("unexpected filter %#v", filter)
+	}
+}
+
+func TestRequestLogFormat(t *testing.T) {
+	tests := []struct {
+		config RequestLogConfiguration
+		valid  bool
+	}{
+		{RequestLogConfiguration{}, true},
+		{RequestLogConfiguration{Format: "json", TimeZone: "UTC", LatencyUnit: "us"}, true},
+		{RequestLogConfiguration{Format: "%{method} %{status}"}, true},
+		{RequestLogConfiguration{Format: "xml"}, false},
+		{RequestLogConfiguration{Format: "%{unknown}"}, false},
+		{RequestLogConfiguration{TimeZone: "Unknown/Zone"}, false},
+		{RequestLogConfiguration{LatencyUnit: "s"}, false},
+	}
+	for _, test := range tests {
+		_, err := test.config.buildFormatter()
+		if test.valid != (err == nil) {
+			t.Fatalf("unexpected error for %+v: %v", test.config, err)
+		}
+	}
+}
+
+// bufferAppenderFactory is a custom request log appender.
+type bufferAppenderFactory struct {
+	buf bytes.Buffer
+}
+
+func (f *bufferAppenderFactory) BuildRequestLog(*core.Environment) (io.Writer, error) {
+	return &f.buf, nil
+}
+
+func TestRequestLogAppenders(t *testing.T) {
+	console := &logging.ConsoleAppenderFactory{}
+	console.Threshold = "ERROR"
+	custom := &bufferAppenderFactory{}
+
+	config := RequestLogConfiguration{
+		Appenders: make([]logging.AppenderConfiguration, 2),
+		Format:    "%{status}",
+	}
+	config.Appenders[0].SetValue(console)
+	config.Appenders[1].SetValue(custom)
+
+	f, err := config.Build(core.NewEnvironment())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := filter.NewChain()
+	chain.Add(f, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if "404\n" != custom.buf.String() {
+		t.Fatalf("unexpected request log: %q", custom.buf.String())
+	}
+}
+
+func TestRequestLogThreshold(t *testing.T) {
+	var info, errors bytes.Buffer
+	w := &requestLogWriter{
+		appenders: []requestLogAppender{
+			{writer: &info},
+			{writer: &errors, threshold: gol.Error},
+		},
+	}
+	w.WriteLevel(gol.Info, []byte("1"))
+	w.WriteLevel(gol.Warn, []byte("2"))
+	w.WriteLevel(gol.Error, []byte("3"))
+	if "123" != info.String() || "3" != errors.String() {
+		t.Fatalf("unexpected output: %q %q", info.String(), errors.String())
+	}
+
+	console := &logging.ConsoleAppenderFactory{}
+	console.Includes = []string{"melon"}
+	if _, err := buildRequestLogAppender(core.NewEnvironment(), console); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestAdminRequestLog(t *testing.T) {
+	app := &bufferAppenderFactory{}
+	admin := &bufferAppenderFactory{}
+	factory := commonFactory{
+		RequestLog: RequestLogConfiguration{
+			Appenders: make([]logging.AppenderConfiguration, 1),
+			Format:    "%{path}",
+		},
+		AdminRequestLog: &RequestLogConfiguration{
+			Appenders: make([]logging.AppenderConfiguration, 1),
+			Format:    "admin %{path}",
+		},
+	}
+	factory.RequestLog.Appenders[0].SetValue(app)
+	factory.AdminRequestLog.Appenders[0].SetValue(admin)
+
+	env := core.NewEnvironment()
+	appHandler := router.New()
+	adminHandler := router.New()
+	contextHandler := router.New()
+	if err := factory.AddFilters(env, appHandler); err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.AddAdminFilters(env, adminHandler); err != nil {
+		t.Fatal(err)
+	}
+	if err := factory.AddFilters(env, contextHandler); err != nil {
+		t.Fatal(err)
+	}
+	appHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a", nil))
+	adminHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/b", nil))
+	contextHandler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/c", nil))
+	if "/a\n/c\n" != app.buf.String() {
+		t.Fatalf("unexpected request log: %q", app.buf.String())
+	}
+	if "admin /b\n" != admin.buf.String() {
+		t.Fatalf("unexpected admin request log: %q", admin.buf.String())
+	}
+}
+
+func TestSlowRequestLogConfiguration(t *testing.T) {
+	tests := []struct {
+		threshold string
+		enabled   bool
+		valid     bool
+	}{
+		{"", false, true},
+		{"500ms", true, true},
+		{"0s", false, false},
+		{"1", false, false},
+	}
+	for _, test := range tests {
+		config := SlowRequestLogConfiguration{Threshold: test.threshold}
+		f, err := config.Build()
+		if test.valid != (err == nil) || test.enabled != (f != nil) {
+			t.Fatalf("unexpected result for %q: %v %v", test.threshold, f, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/filter"
+)
+
+// group is a set of routes sharing path prefix and filters.
+// It implements core.Router.
+type group struct {
+	router  *Router
+	prefix  string
+	filters []filter.Filter
+}
+
+func newGroup(router *Router, prefix string, filters []http.Handler) *group {
+	g := &group{
+		router: router,
+		prefix: prefix,
+	}
+	for _, f := range filters {
+		g.filters = append(g.filters, f)
+	}
+	g.sortFilters()
+	return g
+}
+
+func (g *group) sortFilters() {
+	sort.SliceStable(g.filters, func(i, j int) bool {
+		return filter.Priority(g.filters[i]) < filter.Priority(g.filters[j])
+	})
+}
+
+// Handle registers the handler for the pattern under the group prefix.
+// The group filters are executed before the handler.
+func (g *group) Handle(method, pattern string, handler http.Handler) {
+	if len(g.filters) > 0 {
+		chain := filter.NewChain()
+		chain.Add(g.filters...)
+		chain.Add(handler)
+		handler = &filteredHandler{
+			chain:   chain,
+			handler: handler,
+		}
+	}
+	g.router.Handle(method, g.prefix+pattern, handler)
+}
+
+// PathPrefix returns path prefix including the prefix of the router.
+func (g *group) PathPrefix() string {
+	return g.router.PathPrefix() + g.prefix
+}
+
+// Endpoints returns all endpoints registered under the group prefix.
+func (g *group) Endpoints() []core.Endpoint {
+	return g.router.endpoints(g.prefix)
+}
+
+// Group returns a sub group which inherits prefix and filters of this group.
+func (g *group) Group(prefix string, filters ...http.Handler) core.Router {
+	sub := newGroup(g.router, g.prefix+cleanPrefix(prefix), filters)
+	sub.filters = append(g.filters[:len(g.filters):len(g.filters)], sub.filters...)
+	sub.sortFilters()
+	return sub
+}
+
+// Filters returns filters of the router followed by filters of the group.
+func (g *group) Filters() []string {
+	return append(g.router.Filters(), filterNames(g.filters)...)
+}
+
+// filteredHandler executes filter chain which ends with handler.
+type filteredHandler struct {
+	chain   *filter.Chain
+	handler http.Handler
+}
+
+func (h *filteredHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.chain.ServeHTTP(w, r)
+}
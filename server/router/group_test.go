@@ -0,0 +1,109 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/filter"
+)
+
+var _ core.Router = (*group)(nil)
+
+type testFilter string
+
+func (s testFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(s))
+	filter.Continue(w, r)
+}
+
+type nopFilter struct{}
+
+func (nopFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	filter.Continue(w, r)
+}
+
+func TestGroupAllocs(t *testing.T) {
+	r := New()
+	r.Group("/v2", nopFilter{}).Handle("GET", "/users", testHandler(""))
+	chain := filter.NewChain()
+	chain.Add(r.routes[0].handlers["GET"])
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v2/users", nil)
+	// Group filters run in the cursor of the router chain, so only the
+	// outer chain allocates the cursor and the request.
+	if n := testing.AllocsPerRun(100, func() { chain.ServeHTTP(w, req) }); n != 2 {
+		t.Fatalf("unexpected allocations: %v", n)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	r := New(WithPathPrefix("/app"))
+	r.AddFilter(testFilter("0"))
+	r.Handle("GET", "/users", testHandler("users"))
+
+	g := r.Group("v2/", testFilter("1"))
+	g.Handle("GET", "/orders", testHandler("orders"))
+	sub := g.Group("/admin", testFilter("2"))
+	sub.Handle("POST", "/orders", testHandler("admin"))
+
+	if "/app/v2" != g.PathPrefix() {
+		t.Fatalf("unexpected path prefix: %v", g.PathPrefix())
+	}
+	if "/app/v2/admin" != sub.PathPrefix() {
+		t.Fatalf("unexpected path prefix: %v", sub.PathPrefix())
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/app/users", "0users"},
+		{"GET", "/app/v2/orders", "01orders"},
+		{"POST", "/app/v2/admin/orders", "012admin"},
+		{"GET", "/app/v2/admin/orders", "0Method Not Allowed\n"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if test.body != w.Body.String() {
+			t.Errorf("unexpected response for %s %s: %q", test.method, test.path, w.Body.String())
+		}
+	}
+	expected := []core.Endpoint{
+		{Method: "POST", Path: "/app/v2/admin/orders", Handler: "http.HandlerFunc"},
+		{Method: "OPTIONS", Path: "/app/v2/admin/orders", Handler: "*router.optionsHandler"},
+	}
+	if !reflect.DeepEqual(expected, sub.Endpoints()) {
+		t.Fatalf("unexpected endpoints: %#v", sub.Endpoints())
+	}
+	if 8 != len(r.Endpoints()) {
+		t.Fatalf("unexpected endpoints: %#v", r.Endpoints())
+	}
+}
+
+func TestFilters(t *testing.T) {
+	r := New()
+	r.AddFilter(testFilter("1"))
+	r.AddFilter(filter.WithPriority(testFilter("0"), filter.PriorityRequestLog))
+	g := r.Group("/v2", testFilter("3"), filter.WithPriority(testFilter("2"), filter.PriorityAuth))
+	g.Handle("GET", "/", testHandler("end"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v2/", nil))
+	if "0123end" != w.Body.String() {
+		t.Fatalf("unexpected body: %v", w.Body.String())
+	}
+	expected := []string{
+		"100  router.testFilter",
+		"600  router.testFilter",
+		"500  router.testFilter",
+		"600  router.testFilter",
+	}
+	if !reflect.DeepEqual(expected, g.Filters()) {
+		t.Fatalf("unexpected filters: %#v", g.Filters())
+	}
+}
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// constraints are named patterns which can be used in route variables,
+// e.g. /users/{id:int}.
+var constraints = map[string]string{
+	"int":   `-?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// expandPattern replaces named constraints in route variables with their
+// regular expressions and validates all variables in the pattern.
+func expandPattern(pattern string) (string, error) {
+	var buf bytes.Buffer
+	for i := 0; i < len(pattern); {
+		if pattern[i] != '{' {
+			buf.WriteByte(pattern[i])
+			i++
+			continue
+		}
+		end, err := variableEnd(pattern, i)
+		if err != nil {
+			return "", err
+		}
+		v, err := expandVariable(pattern[i+1 : end])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteByte('{')
+		buf.WriteString(v)
+		buf.WriteByte('}')
+		i = end + 1
+	}
+	return buf.String(), nil
+}
+
+// variableEnd returns index of the brace closing the variable started at i.
+func variableEnd(pattern string, i int) (int, error) {
+	level := 0
+	for j := i; j < len(pattern); j++ {
+		switch pattern[j] {
+		case '{':
+			level++
+		case '}':
+			level--
+			if level == 0 {
+				return j, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("router: unbalanced braces in pattern %q", pattern)
+}
+
+// expandVariable expands variable in form of name or name:constraint.
+func expandVariable(v string) (string, error) {
+	idx := strings.Index(v, ":")
+	if idx < 0 {
+		if v == "" {
+			return "", fmt.Errorf("router: missing variable name")
+		}
+		return v, nil
+	}
+	name, constraint := v[:idx], v[idx+1:]
+	if name == "" {
+		return "", fmt.Errorf("router: missing variable name in {%s}", v)
+	}
+	if exp, ok := constraints[constraint]; ok {
+		return name + ":" + exp, nil
+	}
+	if _, err := regexp.Compile("^(?:" + constraint + ")$"); err != nil {
+		return "", fmt.Errorf("router: invalid constraint of variable %s: %v", name, err)
+	}
+	return v, nil
+}
+
+// routeKey returns the expanded pattern without variable names and the names
+// in order, so that patterns matching the same paths, e.g. /users/{id} and
+// /users/{name}, share a route.
+func routeKey(expanded string) (string, []string) {
+	var buf bytes.Buffer
+	var names []string
+	for i := 0; i < len(expanded); {
+		if expanded[i] != '{' {
+			buf.WriteByte(expanded[i])
+			i++
+			continue
+		}
+		// Pattern has been validated by expandPattern.
+		end, _ := variableEnd(expanded, i)
+		v := expanded[i+1 : end]
+		name := v
+		buf.WriteByte('{')
+		if idx := strings.Index(v, ":"); idx >= 0 {
+			name = v[:idx]
+			buf.WriteString(v[idx:])
+		}
+		buf.WriteByte('}')
+		names = append(names, name)
+		i = end + 1
+	}
+	return buf.String(), names
+}
@@ -6,10 +6,15 @@ package router
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"path"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/goburrow/melon/core"
 	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/logging"
 	"github.com/gorilla/mux"
 )
 
@@ -18,11 +23,17 @@ import (
 type Router struct {
 	// serverMux is the HTTP request router.
 	serveMux *mux.Router
+	// pathMux contains routes of serveMux without method matchers, which
+	// are used to find allowed methods of the request path.
+	pathMux *mux.Router
 	// filterChain is the builder for HTTP filters.
 	filterChain *filter.Chain
 
 	pathPrefix string
-	endpoints  []string
+	// routes are registered routes in order, and routesByPattern indexes them
+	// by patterns without variable names.
+	routes          []*route
+	routesByPattern map[string]*route
 }
 
 // New creates a new Router.
@@ -32,30 +43,68 @@ func New(options ...Option) *Router {
 	chain.Add(serveMux)
 
 	r := &Router{
-		serveMux:    serveMux,
-		filterChain: chain,
+		serveMux:        serveMux,
+		pathMux:         mux.NewRouter(),
+		filterChain:     chain,
+		routesByPattern: make(map[string]*route),
 	}
+	serveMux.NotFoundHandler = http.HandlerFunc(r.notFound)
 	for _, opt := range options {
 		opt(r)
 	}
 	return r
 }
 
-// Handle registers the handler for the given pattern.
+// Handle registers the handler for the given method and pattern.
+// Method "*" or empty matches all methods.
+// Requests with method HEAD are served by the GET handler without response
+// body, and OPTIONS requests are responded with allowed methods unless
+// handlers for these methods are registered explicitly.
+// Routes are matched in the order they are registered, a route matches only
+// when it has a handler for the request method. When the path matches some
+// routes but none of them has the method, the router responds
+// 405 Method Not Allowed.
+//
+// Variables in the pattern can have constraints which are either regular
+// expressions or one of int, uint, alpha, alnum and uuid, e.g. /users/{id:int}.
+// Patterns which differ only in variable names, e.g. /users/{id} and
+// /users/{name}, share the same route and each handler receives path
+// parameters with names in its own pattern.
+// Handle panics if the pattern is invalid.
 func (h *Router) Handle(method, pattern string, handler http.Handler) {
-	r := h.serveMux.NewRoute()
-	r.Handler(handler)
-	if method != "" && method != "*" {
-		r.Methods(method)
+	if method == "" {
+		method = "*"
 	}
-	if strings.HasSuffix(pattern, "*") {
-		r.PathPrefix(pattern[:len(pattern)-1])
-	} else {
-		r.Path(pattern)
+	p, err := expandPattern(pattern)
+	if err != nil {
+		panic(err)
 	}
-	// log endpoint
-	endpoint := fmt.Sprintf("%-7s %s%s (%T)", method, h.pathPrefix, pattern, handler)
-	h.endpoints = append(h.endpoints, endpoint)
+	key, names := routeKey(p)
+	rt, ok := h.routesByPattern[key]
+	if !ok {
+		rt = newRoute(pattern, names)
+		rt.template = h.pathPrefix + pattern
+		r := h.serveMux.NewRoute().MatcherFunc(rt.matchMethod)
+		rt.path = h.pathMux.NewRoute()
+		for _, mr := range [...]*mux.Route{r, rt.path} {
+			if strings.HasSuffix(p, "*") {
+				mr.PathPrefix(p[:len(p)-1])
+			} else {
+				mr.Path(p)
+			}
+			if err = mr.GetError(); err != nil {
+				panic(fmt.Errorf("router: invalid pattern %q: %v", pattern, err))
+			}
+		}
+		r.Handler(rt)
+		h.routes = append(h.routes, rt)
+		h.routesByPattern[key] = rt
+	}
+	if pattern != rt.pattern {
+		// Same route with different variable names
+		handler = newRenamedHandler(handler, pattern, rt.names, names)
+	}
+	rt.handle(strings.ToUpper(method), handler)
 }
 
 // PathPrefix returns server root context path.
@@ -63,28 +112,115 @@ func (h *Router) PathPrefix() string {
 	return h.pathPrefix
 }
 
-// Endpoints returns all registered endpoints.
-func (h *Router) Endpoints() []string {
-	return h.endpoints
+// Endpoints returns all registered endpoints, including those implicitly
+// added for HEAD and OPTIONS.
+func (h *Router) Endpoints() []core.Endpoint {
+	return h.endpoints("")
+}
+
+// endpoints returns endpoints which patterns are under the given prefix.
+func (h *Router) endpoints(prefix string) []core.Endpoint {
+	var endpoints []core.Endpoint
+	for _, rt := range h.routes {
+		if !hasPathPrefix(rt.pattern, prefix) {
+			continue
+		}
+		for _, method := range rt.allMethods() {
+			endpoints = append(endpoints, h.endpoint(method, rt.pattern, rt.handlers[method]))
+		}
+	}
+	return endpoints
+}
+
+// endpoint uses core.EndpointDescriber of the handler if available.
+func (h *Router) endpoint(method, pattern string, handler http.Handler) core.Endpoint {
+	if rh, ok := handler.(*renamedHandler); ok {
+		pattern = rh.pattern
+		handler = rh.handler
+	}
+	if fh, ok := handler.(*filteredHandler); ok {
+		handler = fh.handler
+	}
+	e := core.Endpoint{
+		Method:  method,
+		Path:    h.pathPrefix + pattern,
+		Handler: fmt.Sprintf("%T", handler),
+	}
+	if d, ok := handler.(core.EndpointDescriber); ok {
+		d.DescribeEndpoint(&e)
+	}
+	return e
+}
+
+// notFound responds 405 Method Not Allowed with methods of all routes
+// matching the request path, or 404 Not Found if there is none.
+func (h *Router) notFound(w http.ResponseWriter, r *http.Request) {
+	var methods []string
+	var match mux.RouteMatch
+	for _, rt := range h.routes {
+		if !rt.path.Match(r, &match) {
+			continue
+		}
+		for m := range rt.handlers {
+			if m != "*" && !containsString(methods, m) {
+				methods = append(methods, m)
+			}
+		}
+	}
+	if len(methods) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	sort.Strings(methods)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+// Group returns a Router which registers handlers with the given path prefix
+// and applies filters only to these handlers.
+func (h *Router) Group(prefix string, filters ...http.Handler) core.Router {
+	return newGroup(h, cleanPrefix(prefix), filters)
 }
 
 // ServeHTTP strips path prefix in the request and executes filter chain,
-// which should include ServeMux as the last one.
+// which should include ServeMux as the last one. The URL of r is copied
+// instead of modified as outer filters may still read it concurrently.
 func (h *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if h.pathPrefix != "" {
 		p := strings.TrimPrefix(r.URL.Path, h.pathPrefix)
 		if p == "" {
 			p = "/"
 		}
-		r.URL.Path = p
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		r = r2
 	}
 	h.filterChain.ServeHTTP(w, r)
 }
 
-// AddFilter adds a filter middleware.
+// AddFilter adds a filter middleware. Filters are ordered by their priority
+// and then by the order they are added.
 func (h *Router) AddFilter(f filter.Filter) {
 	// Filter f is always added before the last filter, which is server mux.
-	h.filterChain.Insert(f, h.filterChain.Length()-1)
+	h.filterChain.InsertSorted(f, 1)
+}
+
+// Filters returns priorities and names of all filters in execution order.
+func (h *Router) Filters() []string {
+	filters := h.filterChain.Filters()
+	// Exclude server mux
+	return filterNames(filters[:len(filters)-1])
+}
+
+func filterNames(filters []filter.Filter) []string {
+	names := make([]string, len(filters))
+	for i, f := range filters {
+		names[i] = fmt.Sprintf("%-4d %s", filter.Priority(f), filter.Name(f))
+	}
+	return names
 }
 
 // Option is router options.
@@ -93,20 +229,229 @@ type Option func(r *Router)
 // WithPathPrefix returns an Option which sets path prefix for Router.
 // If there is no leading slash, it will be added to prefix.
 func WithPathPrefix(prefix string) Option {
+	prefix = cleanPrefix(prefix)
+	return func(r *Router) {
+		r.pathPrefix = prefix
+	}
+}
+
+// cleanPrefix cleans prefix and adds leading slash if necessary.
+func cleanPrefix(prefix string) string {
 	prefix = strings.TrimSpace(prefix)
 	if prefix != "" {
-		// Clean and add leading slash if necessary
 		prefix = path.Clean(prefix)
 		if prefix[0] != '/' {
 			prefix = "/" + prefix
 		}
 	}
-	return func(r *Router) {
-		r.pathPrefix = prefix
+	return prefix
+}
+
+// containsString checks if s contains v.
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
 	}
+	return false
+}
+
+// hasPathPrefix checks if path p is under prefix.
+func hasPathPrefix(p, prefix string) bool {
+	if prefix == "" || prefix == "/" || p == prefix {
+		return true
+	}
+	return strings.HasPrefix(p, prefix) && p[len(prefix)] == '/'
 }
 
 // PathParams returns path parameters from the path of the request.
 func PathParams(r *http.Request) map[string]string {
 	return mux.Vars(r)
 }
+
+// route contains handlers of all methods for a pattern.
+type route struct {
+	pattern string
+	// template is the pattern including path prefix of the router, which is
+	// recorded in the request log.
+	template string
+	// methods are explicitly registered methods in order.
+	methods []string
+	// names are variable names in the pattern.
+	names []string
+	// path matches the pattern regardless of request method.
+	path *mux.Route
+	// handlers contains handlers of both explicit and implicit methods.
+	handlers map[string]http.Handler
+	// allow is value of Allow header.
+	allow string
+}
+
+func newRoute(pattern string, names []string) *route {
+	return &route{
+		pattern:  pattern,
+		names:    names,
+		handlers: make(map[string]http.Handler),
+	}
+}
+
+// handle adds or replaces handler for method and updates implicit handlers.
+func (rt *route) handle(method string, handler http.Handler) {
+	if !rt.isExplicit(method) {
+		rt.methods = append(rt.methods, method)
+	}
+	rt.handlers[method] = handler
+	// Implicit handlers
+	if get, ok := rt.handlers["GET"]; ok && !rt.isExplicit("HEAD") {
+		rt.handlers["HEAD"] = &headHandler{get}
+	}
+	if !rt.isExplicit("OPTIONS") && !rt.isExplicit("*") {
+		rt.handlers["OPTIONS"] = &optionsHandler{rt}
+	}
+	methods := make([]string, 0, len(rt.handlers))
+	for m := range rt.handlers {
+		if m != "*" {
+			methods = append(methods, m)
+		}
+	}
+	sort.Strings(methods)
+	rt.allow = strings.Join(methods, ", ")
+}
+
+func (rt *route) isExplicit(method string) bool {
+	return containsString(rt.methods, method)
+}
+
+// allMethods returns explicit methods followed by implicit ones.
+func (rt *route) allMethods() []string {
+	methods := rt.methods
+	for _, m := range [...]string{"HEAD", "OPTIONS"} {
+		if _, ok := rt.handlers[m]; ok && !rt.isExplicit(m) {
+			methods = append(methods[:len(methods):len(methods)], m)
+		}
+	}
+	return methods
+}
+
+// handler returns the handler of method or the one of all methods.
+func (rt *route) handler(method string) (http.Handler, bool) {
+	if handler, ok := rt.handlers[method]; ok {
+		return handler, true
+	}
+	handler, ok := rt.handlers["*"]
+	return handler, ok
+}
+
+// matchMethod is a mux.MatcherFunc which lets requests fall through to
+// later routes when this route has no handler for the request method.
+func (rt *route) matchMethod(r *http.Request, match *mux.RouteMatch) bool {
+	_, ok := rt.handler(r.Method)
+	return ok
+}
+
+// ServeHTTP dispatches request to the handler of request method.
+func (rt *route) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := rt.handler(r.Method)
+	if !ok {
+		// Route is only matched when it has the method.
+		http.NotFound(w, r)
+		return
+	}
+	rt.serve(handler, w, r)
+}
+
+// serve executes handler and records the route and time spent in the handler
+// to the request log entry if exists. When routers are nested, the innermost
+// route is recorded.
+func (rt *route) serve(handler http.Handler, w http.ResponseWriter, r *http.Request) {
+	entry := logging.FromRequest(r)
+	if entry == nil {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	entry.Route = rt.template
+	start := time.Now()
+	handler.ServeHTTP(w, r)
+	if entry.HandlerLatency == 0 {
+		entry.HandlerLatency = time.Since(start)
+	}
+}
+
+// renamedHandler serves a handler registered with a pattern which differs
+// from the pattern of its route only in variable names. Path parameters are
+// renamed to those in the pattern of the handler.
+type renamedHandler struct {
+	handler http.Handler
+	pattern string
+	// names maps variable names of the route to those of the pattern.
+	names map[string]string
+}
+
+func newRenamedHandler(handler http.Handler, pattern string, from, to []string) *renamedHandler {
+	names := make(map[string]string, len(from))
+	for i := range from {
+		names[from[i]] = to[i]
+	}
+	return &renamedHandler{
+		handler: handler,
+		pattern: pattern,
+		names:   names,
+	}
+}
+
+func (h *renamedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	renamed := make(map[string]string, len(vars))
+	for k, v := range vars {
+		if name, ok := h.names[k]; ok {
+			k = name
+		}
+		renamed[k] = v
+	}
+	h.handler.ServeHTTP(w, mux.SetURLVars(r, renamed))
+}
+
+// headHandler serves HEAD requests using GET handler.
+type headHandler struct {
+	handler http.Handler
+}
+
+func (h *headHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.handler.ServeHTTP(&headResponseWriter{w}, r)
+}
+
+// DescribeEndpoint uses information from GET handler except handler type.
+func (h *headHandler) DescribeEndpoint(e *core.Endpoint) {
+	handler := h.handler
+	if rh, ok := handler.(*renamedHandler); ok {
+		handler = rh.handler
+	}
+	if fh, ok := handler.(*filteredHandler); ok {
+		handler = fh.handler
+	}
+	if d, ok := handler.(core.EndpointDescriber); ok {
+		d.DescribeEndpoint(e)
+		e.Handler = fmt.Sprintf("%T", h)
+	}
+}
+
+// headResponseWriter discards response body.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// optionsHandler responds allowed methods of a route.
+type optionsHandler struct {
+	route *route
+}
+
+func (h *optionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", h.route.allow)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,10 +1,14 @@
 package router
 
 import (
+	"bytes"
 	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"testing"
 
 	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/logging"
 )
 
 var _ core.Router = (*Router)(nil)
@@ -26,3 +30,252 @@ func TestPathPrefix(t *testing.T) {
 		}
 	}
 }
+
+func TestStripPathPrefix(t *testing.T) {
+	var path string
+	rt := New(WithPathPrefix("/app"))
+	rt.Handle("GET", "/users", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	r := httptest.NewRequest("GET", "/app/users", nil)
+	rt.ServeHTTP(httptest.NewRecorder(), r)
+	if path != "/users" || r.URL.Path != "/app/users" {
+		t.Fatalf("unexpected paths: %s %s", path, r.URL.Path)
+	}
+}
+
+func testHandler(s string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(s))
+	})
+}
+
+func TestMethods(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/users", testHandler("list"))
+	r.Handle("POST", "/users", testHandler("create"))
+	r.Handle("*", "/any", testHandler("any"))
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+		allow  string
+	}{
+		{"GET", "/users", 200, "list", ""},
+		{"POST", "/users", 200, "create", ""},
+		{"HEAD", "/users", 200, "", ""},
+		{"OPTIONS", "/users", 200, "", "GET, HEAD, OPTIONS, POST"},
+		{"DELETE", "/users", 405, "Method Not Allowed\n", "GET, HEAD, OPTIONS, POST"},
+		{"DELETE", "/any", 200, "any", ""},
+		{"OPTIONS", "/any", 200, "any", ""},
+		{"GET", "/none", 404, "404 page not found\n", ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if test.code != w.Code || test.body != w.Body.String() || test.allow != w.Header().Get("Allow") {
+			t.Errorf("unexpected response for %s %s: %d %q %v", test.method, test.path, w.Code, w.Body.String(), w.Header())
+		}
+	}
+}
+
+func TestOverlappingRoutes(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/files/*", testHandler("files"))
+	r.Handle("POST", "/files/upload", testHandler("upload"))
+	r.Handle("GET", "/users/{id:int}", testHandler("user"))
+	r.Handle("POST", "/users/{action}", testHandler("action"))
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+		allow  string
+	}{
+		{"GET", "/files/upload", 200, "files", ""},
+		{"POST", "/files/upload", 200, "upload", ""},
+		{"POST", "/files/a", 405, "Method Not Allowed\n", "GET, HEAD, OPTIONS"},
+		{"GET", "/users/5", 200, "user", ""},
+		{"POST", "/users/5", 200, "action", ""},
+		{"DELETE", "/users/5", 405, "Method Not Allowed\n", "GET, HEAD, OPTIONS, POST"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if test.code != w.Code || test.body != w.Body.String() || test.allow != w.Header().Get("Allow") {
+			t.Errorf("unexpected response for %s %s: %d %q %v", test.method, test.path, w.Code, w.Body.String(), w.Header())
+		}
+	}
+}
+
+func TestExplicitMethods(t *testing.T) {
+	r := New()
+	r.Handle("HEAD", "/users", testHandler("head"))
+	r.Handle("GET", "/users", testHandler("list"))
+	r.Handle("OPTIONS", "/users", testHandler("options"))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("HEAD", "/users", nil))
+	if "head" != w.Body.String() {
+		t.Fatalf("unexpected response: %q", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/users", nil))
+	if "options" != w.Body.String() {
+		t.Fatalf("unexpected response: %q", w.Body.String())
+	}
+}
+
+func TestVariableNames(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/users/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("get " + PathParams(r)["id"]))
+	}))
+	r.Handle("DELETE", "/users/{name}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("delete " + PathParams(r)["name"]))
+	}))
+	r.Handle("GET", "/users/{id:int}/posts", testHandler("posts"))
+	r.Handle("POST", "/users/{name:-?[0-9]+}/posts", testHandler("create"))
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/users/1", "get 1"},
+		{"DELETE", "/users/1", "delete 1"},
+		{"GET", "/users/1/posts", "posts"},
+		{"POST", "/users/1/posts", "create"},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != http.StatusOK || test.body != w.Body.String() {
+			t.Errorf("unexpected response for %s %s: %d %q", test.method, test.path, w.Code, w.Body.String())
+		}
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("OPTIONS", "/users/1", nil))
+	if "DELETE, GET, HEAD, OPTIONS" != w.Header().Get("Allow") {
+		t.Fatalf("unexpected allow: %v", w.Header())
+	}
+	endpoints := r.Endpoints()
+	if len(endpoints) < 2 || "/users/{name}" != endpoints[1].Path {
+		t.Fatalf("unexpected endpoints: %+v", endpoints)
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	r := New(WithPathPrefix("/app"))
+	r.Handle("GET", "/users", testHandler("list"))
+	r.Handle("POST", "/users", testHandler("create"))
+	r.Handle("*", "/any", testHandler("any"))
+
+	expected := []core.Endpoint{
+		{Method: "GET", Path: "/app/users", Handler: "http.HandlerFunc"},
+		{Method: "POST", Path: "/app/users", Handler: "http.HandlerFunc"},
+		{Method: "HEAD", Path: "/app/users", Handler: "*router.headHandler"},
+		{Method: "OPTIONS", Path: "/app/users", Handler: "*router.optionsHandler"},
+		{Method: "*", Path: "/app/any", Handler: "http.HandlerFunc"},
+	}
+	endpoints := r.Endpoints()
+	if !reflect.DeepEqual(expected, endpoints) {
+		t.Fatalf("unexpected endpoints: %#v", endpoints)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/users/{id:int}", testHandler("id"))
+	r.Handle("GET", "/users/{name:alpha}", testHandler("name"))
+	r.Handle("GET", "/orders/{id:uuid}/{n:[0-9]{2}}", testHandler("order"))
+
+	tests := map[string]string{
+		"/users/-12": "id",
+		"/users/abc": "name",
+		"/users/a1":  "404 page not found\n",
+		"/orders/123e4567-e89b-12d3-a456-426655440000/12":  "order",
+		"/orders/123e4567-e89b-12d3-a456-426655440000/123": "404 page not found\n",
+	}
+	for path, expected := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if expected != w.Body.String() {
+			t.Errorf("unexpected response for %s: %q", path, w.Body.String())
+		}
+	}
+	if e := r.Endpoints()[0]; "GET     /users/{id:int} (http.HandlerFunc)" != e.String() {
+		t.Fatalf("unexpected endpoints: %#v", r.Endpoints())
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	patterns := []string{
+		"/users/{id",
+		"/users/{}",
+		"/users/{:int}",
+		"/users/{id:[0-9}",
+	}
+	for _, p := range patterns {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic for pattern %s", p)
+				}
+			}()
+			New().Handle("GET", p, testHandler(""))
+		}()
+	}
+}
+
+type describedHandler struct{}
+
+func (describedHandler) ServeHTTP(http.ResponseWriter, *http.Request) {}
+
+func (describedHandler) DescribeEndpoint(e *core.Endpoint) {
+	e.Name = "users"
+	e.Tags = []string{"user"}
+}
+
+func TestEndpointDescriber(t *testing.T) {
+	r := New()
+	r.Handle("GET", "/users", describedHandler{})
+
+	expected := []core.Endpoint{
+		{Method: "GET", Path: "/users", Handler: "router.describedHandler", Name: "users", Tags: []string{"user"}},
+		{Method: "HEAD", Path: "/users", Handler: "*router.headHandler", Name: "users", Tags: []string{"user"}},
+		{Method: "OPTIONS", Path: "/users", Handler: "*router.optionsHandler"},
+	}
+	endpoints := r.Endpoints()
+	if !reflect.DeepEqual(expected, endpoints) {
+		t.Fatalf("unexpected endpoints: %#v", endpoints)
+	}
+}
+
+func TestRequestLogRoute(t *testing.T) {
+	var buf bytes.Buffer
+	format, err := logging.NewTemplateFormat("%{route}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := New(WithPathPrefix("/api"))
+	sub.Handle("GET", "/users/{id}", testHandler("user"))
+	root := New()
+	root.Handle("*", "/api/*", sub)
+	root.AddFilter(logging.NewFilter(&buf, logging.WithFormatter(format)))
+
+	for path, route := range map[string]string{
+		"/api/users/1": "/api/users/{id}",
+		"/api/":        "/api/*",
+		"/users":       "-",
+	} {
+		buf.Reset()
+		root.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		if buf.String() != route+"\n" {
+			t.Errorf("unexpected route of %s: %q, want: %q", path, buf.String(), route)
+		}
+	}
+}
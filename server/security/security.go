@@ -0,0 +1,156 @@
+/*
+Package security provides a filter which adds security headers to responses.
+*/
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goburrow/melon/server/filter"
+)
+
+const (
+	// DefaultHSTSMaxAge is the default max-age of Strict-Transport-Security.
+	DefaultHSTSMaxAge = 365 * 24 * time.Hour
+	// DefaultFrameOptions is the default value of X-Frame-Options.
+	DefaultFrameOptions = "DENY"
+	// DefaultReferrerPolicy is the default value of Referrer-Policy.
+	DefaultReferrerPolicy = "strict-origin-when-cross-origin"
+
+	// NoncePlaceholder is replaced with a random nonce for each request
+	// in Content-Security-Policy.
+	NoncePlaceholder = "{nonce}"
+)
+
+// securityFilter sets security headers.
+type securityFilter struct {
+	hsts           string
+	frameOptions   string
+	referrerPolicy string
+	csp            string
+	cspNonce       bool
+}
+
+// Option is a Filter option.
+type Option func(f *securityFilter)
+
+// NewFilter returns a Filter which adds X-Content-Type-Options, X-Frame-Options,
+// Referrer-Policy to all responses and Strict-Transport-Security to responses
+// of HTTPS requests.
+func NewFilter(options ...Option) filter.Filter {
+	f := &securityFilter{
+		frameOptions:   DefaultFrameOptions,
+		referrerPolicy: DefaultReferrerPolicy,
+	}
+	WithHSTS(DefaultHSTSMaxAge, false)(f)
+	for _, opt := range options {
+		opt(f)
+	}
+	return f
+}
+
+// WithHSTS sets max-age of Strict-Transport-Security. HSTS is disabled when
+// maxAge is not positive.
+func WithHSTS(maxAge time.Duration, includeSubDomains bool) Option {
+	return func(f *securityFilter) {
+		if maxAge <= 0 {
+			f.hsts = ""
+			return
+		}
+		f.hsts = "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+		if includeSubDomains {
+			f.hsts += "; includeSubDomains"
+		}
+	}
+}
+
+// WithFrameOptions sets X-Frame-Options. An empty value disables the header.
+func WithFrameOptions(value string) Option {
+	return func(f *securityFilter) {
+		f.frameOptions = value
+	}
+}
+
+// WithReferrerPolicy sets Referrer-Policy. An empty value disables the header.
+func WithReferrerPolicy(value string) Option {
+	return func(f *securityFilter) {
+		f.referrerPolicy = value
+	}
+}
+
+// WithContentSecurityPolicy sets Content-Security-Policy. NoncePlaceholder in
+// the policy is replaced with a nonce generated for each request, which can be
+// retrieved with Nonce. For example:
+//
+//	script-src 'self' 'nonce-{nonce}'
+func WithContentSecurityPolicy(policy string) Option {
+	return func(f *securityFilter) {
+		f.csp = policy
+		f.cspNonce = strings.Contains(policy, NoncePlaceholder)
+	}
+}
+
+// Priority returns filter.PrioritySecurity.
+func (f *securityFilter) Priority() int {
+	return filter.PrioritySecurity
+}
+
+func (f *securityFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Set("X-Content-Type-Options", "nosniff")
+	if f.frameOptions != "" {
+		header.Set("X-Frame-Options", f.frameOptions)
+	}
+	if f.referrerPolicy != "" {
+		header.Set("Referrer-Policy", f.referrerPolicy)
+	}
+	if f.hsts != "" && r.TLS != nil {
+		header.Set("Strict-Transport-Security", f.hsts)
+	}
+	if f.csp != "" {
+		if f.cspNonce {
+			nonce := newNonce()
+			header.Set("Content-Security-Policy", strings.Replace(f.csp, NoncePlaceholder, nonce, -1))
+			r = r.WithContext(context.WithValue(r.Context(), nonceContextKey, nonce))
+		} else {
+			header.Set("Content-Security-Policy", f.csp)
+		}
+	}
+	filter.Continue(w, r)
+}
+
+// newNonce returns a random nonce encoded in URL-safe base64, which is valid
+// in CSP and does not need to be escaped in HTML attributes.
+func newNonce() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("melon/security: could not read random bytes: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// contextKey is a value for use with context.WithValue
+type contextKey struct {
+	name string
+}
+
+func (c *contextKey) String() string {
+	return "melon/security context value " + c.name
+}
+
+var nonceContextKey = &contextKey{"nonce"}
+
+// Nonce returns Content-Security-Policy nonce of the request or empty if
+// not available.
+func Nonce(r *http.Request) string {
+	if nonce, ok := r.Context().Value(nonceContextKey).(string); ok {
+		return nonce
+	}
+	return ""
+}
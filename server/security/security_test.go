@@ -0,0 +1,59 @@
+package security
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/server/filter"
+)
+
+func TestFilter(t *testing.T) {
+	var nonce string
+	chain := filter.NewChain()
+	chain.Add(NewFilter(WithContentSecurityPolicy("script-src 'nonce-{nonce}'")),
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce = Nonce(r)
+		}))
+
+	w := httptest.NewRecorder()
+	chain.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	header := w.Header()
+	if "nosniff" != header.Get("X-Content-Type-Options") ||
+		DefaultFrameOptions != header.Get("X-Frame-Options") ||
+		DefaultReferrerPolicy != header.Get("Referrer-Policy") ||
+		"" != header.Get("Strict-Transport-Security") {
+		t.Fatalf("unexpected headers: %v", header)
+	}
+	if nonce == "" || "script-src 'nonce-"+nonce+"'" != header.Get("Content-Security-Policy") {
+		t.Fatalf("unexpected nonce %s: %v", nonce, header)
+	}
+	previous := nonce
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if previous == nonce {
+		t.Fatalf("nonce must be generated for each request: %v", nonce)
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	chain := filter.NewChain()
+	chain.Add(NewFilter(WithHSTS(time.Hour, true), WithFrameOptions("")),
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.TLS = &tls.ConnectionState{}
+	w := httptest.NewRecorder()
+	chain.ServeHTTP(w, r)
+	if "max-age=3600; includeSubDomains" != w.Header().Get("Strict-Transport-Security") {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+	if _, ok := w.Header()["X-Frame-Options"]; ok {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+	if strings.Contains(w.Header().Get("Content-Security-Policy"), "nonce") {
+		t.Fatalf("unexpected headers: %v", w.Header())
+	}
+}
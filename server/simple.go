@@ -2,8 +2,10 @@ package server
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/filter"
 	"github.com/goburrow/melon/server/router"
 )
 
@@ -40,22 +42,70 @@ func (factory *SimpleFactory) BuildServer(env *core.Environment) (core.Managed,
 	return factory.buildServer(env, appHandler, adminHandler)
 }
 
-func (factory *SimpleFactory) buildServer(env *core.Environment, handlers ...*router.Router) (core.Managed, error) {
+func (factory *SimpleFactory) buildServer(env *core.Environment, appHandler, adminHandler *router.Router) (core.Managed, error) {
+	handler, err := factory.buildHandler(env, appHandler, adminHandler)
+	if err != nil {
+		return nil, err
+	}
+	server := newServer()
+	err = server.addConnectors(handler, []Connector{factory.Connector})
+	if err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// buildHandler returns the root handler serving both application and admin.
+func (factory *SimpleFactory) buildHandler(env *core.Environment, appHandler, adminHandler *router.Router) (*router.Router, error) {
 	handler := router.New()
 	// Sub routers (e.g. /application and /admin)
-	for _, h := range handlers {
+	for _, h := range []*router.Router{appHandler, adminHandler} {
 		handler.Handle("*", h.PathPrefix()+"/*", h)
 		handler.Handle("*", h.PathPrefix(), http.RedirectHandler(h.PathPrefix()+"/", http.StatusMovedPermanently))
 	}
-	// Default filters are only needed in the root handler.
-	err := factory.commonFactory.AddFilters(env, handler)
+	err := factory.addFilters(env, handler, adminHandler.PathPrefix())
 	if err != nil {
 		return nil, err
 	}
-	server := newServer()
-	err = server.addConnectors(handler, []Connector{factory.Connector})
+	return handler, nil
+}
+
+// addFilters adds default filters to the root handler. The timeout is not
+// applied to admin requests. When admin requests have their own request log,
+// the request log filter is chosen by the path of the request, so that
+// panics, timeouts and requests not matching any sub routers are still
+// recorded.
+func (factory *SimpleFactory) addFilters(env *core.Environment, handler *router.Router, adminPrefix string) error {
+	isAdmin := func(w http.ResponseWriter, r *http.Request) bool {
+		return r.URL.Path == adminPrefix || strings.HasPrefix(r.URL.Path, adminPrefix+"/")
+	}
+	isApp := func(w http.ResponseWriter, r *http.Request) bool {
+		return !isAdmin(w, r)
+	}
+	timeoutFilter, err := factory.Timeout.Build()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return server, nil
+	if timeoutFilter != nil {
+		timeoutFilter = &filter.If{F: timeoutFilter, C: isApp}
+	}
+	requestLog, err := factory.requestLogFilter(env)
+	if err != nil {
+		return err
+	}
+	if factory.AdminRequestLog == nil {
+		return factory.commonFactory.addFilters(env, requestLog, timeoutFilter, handler)
+	}
+	adminRequestLog, err := factory.adminRequestLogFilter(env)
+	if err != nil {
+		return err
+	}
+	// Added before other filters of the same priority, e.g. slow request log.
+	if requestLog != nil {
+		handler.AddFilter(&filter.If{F: requestLog, C: isApp})
+	}
+	if adminRequestLog != nil {
+		handler.AddFilter(&filter.If{F: adminRequestLog, C: isAdmin})
+	}
+	return factory.commonFactory.addFilters(env, nil, timeoutFilter, handler)
 }
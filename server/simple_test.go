@@ -1,9 +1,13 @@
 package server
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/logging"
+	"github.com/goburrow/melon/server/router"
 )
 
 var _ core.ServerFactory = (*SimpleFactory)(nil)
@@ -26,3 +30,50 @@ func TestSimpleFactory(t *testing.T) {
 		t.Fatal("Admin.ServerHandler is nil")
 	}
 }
+
+func TestSimpleFactoryAdminRequestLog(t *testing.T) {
+	app := &bufferAppenderFactory{}
+	admin := &bufferAppenderFactory{}
+	factory := newSimpleFactory()
+	factory.RequestLog = RequestLogConfiguration{
+		Appenders: make([]logging.AppenderConfiguration, 1),
+		Format:    "%{uri} %{status} %{timed_out}",
+	}
+	factory.AdminRequestLog = &RequestLogConfiguration{
+		Appenders: make([]logging.AppenderConfiguration, 1),
+		Format:    "admin %{uri} %{status}",
+	}
+	factory.Timeout.Timeout = "20ms"
+	factory.RequestLog.Appenders[0].SetValue(app)
+	factory.AdminRequestLog.Appenders[0].SetValue(admin)
+
+	env := core.NewEnvironment()
+	appHandler := router.New(router.WithPathPrefix(factory.ApplicationContextPath))
+	adminHandler := router.New(router.WithPathPrefix(factory.AdminContextPath))
+	appHandler.Handle("GET", "/panic", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("test")
+	}))
+	appHandler.Handle("GET", "/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	adminHandler.Handle("GET", "/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Admin requests have no timeout.
+		if _, ok := r.Context().Deadline(); ok {
+			t.Errorf("unexpected deadline in admin request")
+		}
+	}))
+	handler, err := factory.buildHandler(env, appHandler, adminHandler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/application/panic", "/application/slow", "/none", "/admin/ping"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	expected := "/application/panic 500 false\n/application/slow 503 true\n/none 404 false\n"
+	if expected != app.buf.String() {
+		t.Fatalf("unexpected request log: %q", app.buf.String())
+	}
+	if "admin /admin/ping 200\n" != admin.buf.String() {
+		t.Fatalf("unexpected admin request log: %q", admin.buf.String())
+	}
+}
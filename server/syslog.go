@@ -0,0 +1,60 @@
+//go:build !windows && !nacl && !plan9
+// +build !windows,!nacl,!plan9
+
+package server
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/goburrow/gol"
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/logging"
+)
+
+func buildSyslogWriter(env *core.Environment, config *logging.SyslogAppenderFactory) (io.Writer, error) {
+	facility, err := logging.ParseFacility(config.Facility)
+	if err != nil {
+		return nil, err
+	}
+	// Syslog facilities of gol have the same values as those of log/syslog.
+	w, err := syslog.Dial(config.Network, config.Addr, syslog.Priority(facility)|syslog.LOG_INFO, "")
+	if err != nil {
+		return nil, err
+	}
+	writer := &syslogWriter{w}
+	env.Lifecycle.Manage(writer)
+	return writer, nil
+}
+
+// syslogWriter writes request log entries with severity according to
+// their levels.
+type syslogWriter struct {
+	*syslog.Writer
+}
+
+func (w *syslogWriter) WriteLevel(level gol.Level, p []byte) (int, error) {
+	var err error
+	switch {
+	case level >= gol.Error:
+		err = w.Err(string(p))
+	case level >= gol.Warn:
+		err = w.Warning(string(p))
+	default:
+		err = w.Info(string(p))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Start does nothing as the connection has been established.
+func (w *syslogWriter) Start() error {
+	return nil
+}
+
+// Stop closes connection to the syslog server.
+func (w *syslogWriter) Stop() error {
+	return w.Close()
+}
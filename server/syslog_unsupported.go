@@ -0,0 +1,16 @@
+//go:build windows || nacl || plan9
+// +build windows nacl plan9
+
+package server
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/logging"
+)
+
+func buildSyslogWriter(env *core.Environment, config *logging.SyslogAppenderFactory) (io.Writer, error) {
+	return nil, fmt.Errorf("server: syslog is not supported on this platform")
+}
@@ -0,0 +1,309 @@
+/*
+Package timeout provides a filter which limits the time to serve a request.
+*/
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/logging"
+)
+
+// timeoutFilter responds with an error when the request is not handled
+// within the given time.
+type timeoutFilter struct {
+	timeout time.Duration
+	// header is the request header which clients use to provide their timeout.
+	header string
+}
+
+// Option is a Filter option.
+type Option func(f *timeoutFilter)
+
+// NewFilter returns a Filter which attaches a deadline to the request context
+// and responds 503 Service Unavailable when the handler does not finish before
+// that deadline. If timeout is not positive, only timeout provided by clients
+// is used. Timed out requests are marked in the request log (see
+// logging.Entry.TimedOut).
+//
+// The response is buffered until the handler returns, so the filter should not
+// be used for streaming responses.
+func NewFilter(timeout time.Duration, options ...Option) filter.Filter {
+	f := &timeoutFilter{
+		timeout: timeout,
+	}
+	for _, opt := range options {
+		opt(f)
+	}
+	return f
+}
+
+// WithDeadlineHeader allows clients to set a shorter timeout in the given
+// request header. The value is either a duration (e.g. 500ms) or a number of
+// milliseconds. The filter responds 504 Gateway Timeout when that timeout
+// is exceeded.
+func WithDeadlineHeader(name string) Option {
+	return func(f *timeoutFilter) {
+		f.header = http.CanonicalHeaderKey(name)
+	}
+}
+
+// Priority returns filter.PriorityTimeout.
+func (f *timeoutFilter) Priority() int {
+	return filter.PriorityTimeout
+}
+
+func (f *timeoutFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var clientTimeout time.Duration
+	if f.header != "" {
+		if d, ok := parseTimeout(r.Header.Get(f.header)); ok {
+			clientTimeout = d
+		}
+	}
+	if f.timeout <= 0 && clientTimeout <= 0 {
+		filter.Continue(w, r)
+		return
+	}
+	ctx := newContext(r.Context(), f.timeout, clientTimeout)
+	defer ctx.cancel()
+
+	tw := &timeoutWriter{
+		w:      w,
+		header: make(http.Header),
+		ctx:    ctx,
+	}
+	// The goroutine has its own filter chain cursor and request log entry
+	// as it may still be running after the filter returns.
+	req := logging.Detach(filter.Fork(r.WithContext(ctx)))
+	done := make(chan struct{})
+	panicChan := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicChan <- p
+			}
+		}()
+		filter.Continue(tw, req)
+		close(done)
+	}()
+	finished := false
+	select {
+	case p := <-panicChan:
+		// Let outer filters handle the panic.
+		logging.Attach(r, req)
+		panic(p)
+	case <-done:
+		finished = true
+	case <-ctx.Done():
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.timedOut = true
+	if finished {
+		logging.Attach(r, req)
+		tw.flush()
+	} else if ctx.Err() == context.DeadlineExceeded {
+		timeout, status := ctx.result()
+		core.GetLogger("melon/server").Warnf("request timed out after %v: %s %s", timeout, r.Method, r.URL.Path)
+		logging.SetTimedOut(r)
+		http.Error(w, http.StatusText(status), status)
+	}
+}
+
+// Override changes timeout of the request, which is counted from the time
+// the request was received by the filter. A shorter timeout provided by the
+// client in the deadline header still applies. It returns false if the
+// request was not handled by the filter or it has already timed out.
+func Override(r *http.Request, timeout time.Duration) bool {
+	ctx := fromContext(r.Context())
+	if ctx == nil {
+		return false
+	}
+	return ctx.reset(timeout)
+}
+
+// parseTimeout parses duration or number of milliseconds.
+func parseTimeout(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Duration(ms) * time.Millisecond, ms > 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+// timeoutWriter buffers response until the handler finishes.
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+	buf    bytes.Buffer
+	ctx    context.Context
+
+	mu       sync.Mutex
+	timedOut bool
+	status   int
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.ctx.Err() == context.DeadlineExceeded {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
+
+// flush writes buffered response to the underlying writer.
+func (tw *timeoutWriter) flush() {
+	dst := tw.w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	tw.w.WriteHeader(tw.status)
+	tw.w.Write(tw.buf.Bytes())
+}
+
+// timeoutContext is a context which deadline can be changed.
+type timeoutContext struct {
+	context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	start time.Time
+	// client is the deadline provided by the client or zero.
+	client   time.Time
+	deadline time.Time
+	timer    *time.Timer
+	exceeded bool
+}
+
+func newContext(parent context.Context, timeout, clientTimeout time.Duration) *timeoutContext {
+	ctx, cancel := context.WithCancel(parent)
+	c := &timeoutContext{
+		Context: ctx,
+		cancel:  cancel,
+		start:   time.Now(),
+	}
+	if clientTimeout > 0 {
+		c.client = c.start.Add(clientTimeout)
+	}
+	c.deadline = c.deadlineOf(timeout)
+	c.timer = time.AfterFunc(c.deadline.Sub(c.start), c.expire)
+	return c
+}
+
+// deadlineOf returns the earlier of the client deadline and the timeout
+// counted from start. Timeout is ignored if it is not positive.
+func (c *timeoutContext) deadlineOf(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return c.client
+	}
+	deadline := c.start.Add(timeout)
+	if !c.client.IsZero() && c.client.Before(deadline) {
+		return c.client
+	}
+	return deadline
+}
+
+func (c *timeoutContext) expire() {
+	c.mu.Lock()
+	c.exceeded = true
+	c.mu.Unlock()
+	c.cancel()
+}
+
+func (c *timeoutContext) reset(timeout time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exceeded || !c.timer.Stop() {
+		return false
+	}
+	c.deadline = c.deadlineOf(timeout)
+	c.timer.Reset(c.deadline.Sub(time.Now()))
+	return true
+}
+
+// result returns the timeout which has been applied and the response status,
+// which is 504 Gateway Timeout if the deadline was provided by the client or
+// 503 Service Unavailable otherwise.
+func (c *timeoutContext) result() (time.Duration, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := http.StatusServiceUnavailable
+	if c.deadline.Equal(c.client) {
+		status = http.StatusGatewayTimeout
+	}
+	return c.deadline.Sub(c.start), status
+}
+
+// Deadline returns the current deadline.
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, true
+}
+
+// Err returns context.DeadlineExceeded if timed out.
+func (c *timeoutContext) Err() error {
+	c.mu.Lock()
+	exceeded := c.exceeded
+	c.mu.Unlock()
+	if exceeded {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// Value returns the context itself for timeoutContextKey.
+func (c *timeoutContext) Value(key interface{}) interface{} {
+	if key == timeoutContextKey {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+// contextKey is a value for use with context.WithValue
+type contextKey struct {
+	name string
+}
+
+func (c *contextKey) String() string {
+	return "melon/timeout context value " + c.name
+}
+
+var timeoutContextKey = &contextKey{"timeout"}
+
+func fromContext(ctx context.Context) *timeoutContext {
+	if c, ok := ctx.Value(timeoutContextKey).(*timeoutContext); ok {
+		return c
+	}
+	return nil
+}
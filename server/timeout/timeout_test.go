@@ -0,0 +1,183 @@
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/logging"
+)
+
+func serve(f filter.Filter, h http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	chain := filter.NewChain()
+	chain.Add(f, h)
+	w := httptest.NewRecorder()
+	chain.ServeHTTP(w, r)
+	return w
+}
+
+func TestNoTimeout(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Errorf("deadline is not set: %v", r.Context())
+		}
+		w.Header().Set("X-Test", "1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("ok"))
+	}
+	w := serve(NewFilter(time.Second), h, httptest.NewRequest("GET", "/", nil))
+	if http.StatusCreated != w.Code || "ok" != w.Body.String() || "1" != w.Header().Get("X-Test") {
+		t.Fatalf("unexpected response: %v %v %v", w.Code, w.Header(), w.Body.String())
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	errCh := make(chan error, 1)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		errCh <- r.Context().Err()
+		_, err := w.Write([]byte("late"))
+		if err != http.ErrHandlerTimeout {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	w := serve(NewFilter(10*time.Millisecond), h, httptest.NewRequest("GET", "/", nil))
+	if http.StatusServiceUnavailable != w.Code {
+		t.Fatalf("unexpected status code: %v", w.Code)
+	}
+	if err := <-errCh; err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestDeadlineHeader(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Timeout", "10")
+	w := serve(NewFilter(time.Minute, WithDeadlineHeader("x-request-timeout")), h, r)
+	if http.StatusGatewayTimeout != w.Code {
+		t.Fatalf("unexpected status code: %v", w.Code)
+	}
+	r.Header.Set("X-Request-Timeout", "10ms")
+	w = serve(NewFilter(0, WithDeadlineHeader("x-request-timeout")), h, r)
+	if http.StatusGatewayTimeout != w.Code {
+		t.Fatalf("unexpected status code: %v", w.Code)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !Override(r, time.Minute) {
+			t.Errorf("could not override timeout")
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}
+	w := serve(NewFilter(10*time.Millisecond), h, httptest.NewRequest("GET", "/", nil))
+	if http.StatusOK != w.Code || "ok" != w.Body.String() {
+		t.Fatalf("unexpected response: %v %v", w.Code, w.Body.String())
+	}
+	if Override(httptest.NewRequest("GET", "/", nil), time.Second) {
+		t.Fatal("override must fail without filter")
+	}
+}
+
+func TestOverrideDeadlineHeader(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !Override(r, time.Minute) {
+			t.Errorf("could not override timeout")
+		}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			w.Write([]byte("ok"))
+		}
+	}
+	f := NewFilter(time.Second, WithDeadlineHeader("x-request-timeout"))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Timeout", "20ms")
+	w := serve(f, h, r)
+	if http.StatusGatewayTimeout != w.Code {
+		t.Fatalf("unexpected response: %v %v", w.Code, w.Body.String())
+	}
+
+	h = func(w http.ResponseWriter, r *http.Request) {
+		if !Override(r, 20*time.Millisecond) {
+			t.Errorf("could not override timeout")
+		}
+		<-r.Context().Done()
+	}
+	r.Header.Set("X-Request-Timeout", "1m")
+	w = serve(f, h, r)
+	if http.StatusServiceUnavailable != w.Code {
+		t.Fatalf("unexpected response: %v %v", w.Code, w.Body.String())
+	}
+}
+
+func TestPanic(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		panic("test")
+	}
+	defer func() {
+		if p := recover(); p != "test" {
+			t.Fatalf("unexpected panic: %v", p)
+		}
+	}()
+	serve(NewFilter(time.Second), h, httptest.NewRequest("GET", "/", nil))
+}
+
+func TestNestedChain(t *testing.T) {
+	released := make(chan struct{})
+	done := make(chan struct{})
+	var after bool
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		<-released
+		filter.Continue(w, r)
+	}
+	inner := filter.NewChain()
+	inner.Add(NewFilter(10*time.Millisecond), http.HandlerFunc(slow))
+	outer := filter.NewChain()
+	outer.Add(http.HandlerFunc(filter.Continue), inner, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		after = true
+	}))
+
+	w := httptest.NewRecorder()
+	outer.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	close(released)
+	<-done
+	if http.StatusServiceUnavailable != w.Code {
+		t.Fatalf("unexpected response: %v %v", w.Code, w.Body.String())
+	}
+	if after {
+		t.Fatal("filter after the inner chain must not be executed")
+	}
+}
+
+func TestRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	format, err := logging.NewTemplateFormat("%{status} %{timed_out} %{principal}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := filter.NewChain()
+	chain.Add(logging.NewFilter(&buf, logging.WithFormatter(format)), NewFilter(50*time.Millisecond))
+	chain.Add(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetPrincipal(r, "user")
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+		}
+	}))
+
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	chain.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+	if "200 false user\n503 true -\n" != buf.String() {
+		t.Fatalf("unexpected request log: %q", buf.String())
+	}
+}
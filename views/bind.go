@@ -0,0 +1,314 @@
+package views
+
+import (
+	"encoding"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	errorType           = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// bindSource provides values of struct fields which have the tag.
+type bindSource struct {
+	tag string
+	// values returns values of the given name and whether it exists.
+	values func(name string) ([]string, bool)
+	// files returns uploaded files of the given name, it can be nil.
+	files func(name string) []*multipart.FileHeader
+}
+
+// binder sets struct fields from bind sources. Nested structs are bound
+// with field names prefixed by the tag of the struct field and a dot, e.g.
+// `form:"address"` and `form:"city"` is bound to "address.city". Structs
+// without tags, including embedded structs, share the parent prefix.
+// A field without value in its source is set to its `default` tag if any.
+type binder struct {
+	sources []bindSource
+	details []ErrorDetail
+}
+
+// bind binds v, which must be a pointer to a struct.
+func (b *binder) bind(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("melon/views: binding requires a pointer to struct: %T", v)
+	}
+	b.bindStruct(rv.Elem(), "")
+	return nil
+}
+
+// err returns a bad request FieldErrorMessage with details of invalid
+// fields, or nil if all fields are valid.
+func (b *binder) err(message string) error {
+	if len(b.details) == 0 {
+		return nil
+	}
+	return &FieldErrorMessage{
+		ErrorMessage: ErrorMessage{
+			Code:    http.StatusBadRequest,
+			Message: message,
+		},
+		Details: b.details,
+	}
+}
+
+// fieldError is implemented by validation errors of a struct field. Field
+// returns the Go name of the field, or names of nested fields separated by
+// dots, e.g. "Page.Size".
+type fieldError interface {
+	error
+	Field() string
+}
+
+// addValidationErrors adds details of field errors reported by validating v,
+// which has been bound, and returns whether err has any field errors.
+// err can be a single error, a slice of errors or implement Errors() []error.
+func (b *binder) addValidationErrors(v interface{}, err error) bool {
+	errs := splitErrors(err)
+	found := false
+	for _, e := range errs {
+		if _, ok := e.(fieldError); ok {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false
+	}
+	t := reflect.TypeOf(v).Elem()
+	for _, e := range errs {
+		var name string
+		if fe, ok := e.(fieldError); ok {
+			name = b.fieldName(t, fe.Field())
+		}
+		b.details = append(b.details, ErrorDetail{
+			Field:   name,
+			Message: e.Error(),
+		})
+	}
+	return true
+}
+
+// fieldName returns the bound name of the field at path of Go field names
+// in struct type t, e.g. "Page.Size" is "page.size" when the fields are
+// tagged with `query:"page"` and `query:"size"`. path is returned as is if
+// the field is not bound.
+func (b *binder) fieldName(t reflect.Type, path string) string {
+	names := strings.Split(path, ".")
+	prefix := ""
+	for i, name := range names {
+		if t.Kind() != reflect.Struct {
+			return path
+		}
+		field, ok := t.FieldByName(name)
+		if !ok {
+			return path
+		}
+		_, tag := b.lookupTag(field.Tag)
+		if tag == "-" {
+			return path
+		}
+		if i == len(names)-1 {
+			if tag == "" {
+				return path
+			}
+			return prefix + tag
+		}
+		if tag != "" {
+			prefix += tag + "."
+		}
+		t = field.Type
+	}
+	return path
+}
+
+// splitErrors returns errors in err if it is a list of errors.
+func splitErrors(err error) []error {
+	if e, ok := err.(interface {
+		Errors() []error
+	}); ok {
+		return e.Errors()
+	}
+	v := reflect.ValueOf(err)
+	if v.Kind() != reflect.Slice || v.Type().Elem() != errorType {
+		return []error{err}
+	}
+	errs := make([]error, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		if e, ok := v.Index(i).Interface().(error); ok && e != nil {
+			errs = append(errs, e)
+		}
+	}
+	return errs
+}
+
+func (b *binder) bindStruct(v reflect.Value, prefix string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// Unexported
+			continue
+		}
+		fv := v.Field(i)
+		source, name := b.lookupTag(field.Tag)
+		if name == "-" {
+			continue
+		}
+		if isBindableStruct(field.Type) {
+			if name != "" {
+				b.bindStruct(fv, prefix+name+".")
+			} else {
+				b.bindStruct(fv, prefix)
+			}
+			continue
+		}
+		if source == nil || !fv.CanSet() {
+			continue
+		}
+		name = prefix + name
+		if field.Type == fileHeaderType || field.Type == fileHeadersType {
+			b.bindFiles(fv, source, name)
+			continue
+		}
+		values, ok := source.values(name)
+		if !ok || len(values) == 0 {
+			def, ok := field.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			values = []string{def}
+		}
+		if err := setValues(fv, values); err != nil {
+			b.details = append(b.details, ErrorDetail{
+				Field:   name,
+				Message: err.Error(),
+			})
+		}
+	}
+}
+
+// lookupTag returns the first source which the tag has.
+func (b *binder) lookupTag(tag reflect.StructTag) (*bindSource, string) {
+	for i := range b.sources {
+		if name, ok := tag.Lookup(b.sources[i].tag); ok {
+			if idx := strings.Index(name, ","); idx >= 0 {
+				name = name[:idx]
+			}
+			return &b.sources[i], name
+		}
+	}
+	return nil, ""
+}
+
+func (b *binder) bindFiles(v reflect.Value, source *bindSource, name string) {
+	if source.files == nil {
+		return
+	}
+	files := source.files(name)
+	if len(files) == 0 {
+		return
+	}
+	if v.Type() == fileHeaderType {
+		v.Set(reflect.ValueOf(files[0]))
+	} else {
+		v.Set(reflect.ValueOf(files))
+	}
+}
+
+// isBindableStruct returns true if t is a struct which is bound field by
+// field instead of from a single value.
+func isBindableStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// setValues sets v to the first value or all values if v is a slice.
+func setValues(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(s.Index(i), value); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+// setValue converts s to the type of v.
+func setValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return invalidValue("value", s)
+		}
+		return nil
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return invalidValue("duration", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		// []byte
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return invalidValue("boolean", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return invalidValue("integer", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return invalidValue("unsigned integer", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return invalidValue("number", s)
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// invalidValue returns the error of value s which is not a valid kind.
+func invalidValue(kind, s string) error {
+	return fmt.Errorf("not a valid %s: %q", kind, s)
+}
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/recovery"
+	"github.com/goburrow/melon/server/requestid"
 )
 
 // ErrorMessage represents a HTTP error with status code and message.
@@ -18,6 +22,19 @@ func (e *ErrorMessage) Error() string {
 	return e.Message
 }
 
+// FieldErrorMessage is an ErrorMessage with details of invalid fields in
+// the request.
+type FieldErrorMessage struct {
+	ErrorMessage
+	Details []ErrorDetail
+}
+
+// ErrorDetail describes an invalid field in the request.
+type ErrorDetail struct {
+	Field   string
+	Message string
+}
+
 // NewBadRequest creates a new ErrorMessage with status code http.StatusBadRequest.
 func NewBadRequest(message string) *ErrorMessage {
 	return &ErrorMessage{
@@ -41,33 +58,57 @@ type ErrorMapper interface {
 
 // errorMapper is a default implementation of ErrorMapper interface.
 type errorMapper struct {
+	reporter core.ErrorReporter
 }
 
-func newErrorMapper() *errorMapper {
-	return &errorMapper{}
+func newErrorMapper(reporter core.ErrorReporter) *errorMapper {
+	return &errorMapper{reporter: reporter}
 }
 
 func (h *errorMapper) MapError(w http.ResponseWriter, r *http.Request, err error) {
 	var errMsg *ErrorMessage
+	// data is written to the response, which is errMsg unless it has details.
+	var data interface{}
 	switch v := err.(type) {
 	case *ErrorMessage:
 		errMsg = v
+	case *FieldErrorMessage:
+		errMsg = &v.ErrorMessage
+		data = v
+	case *recovery.PanicError:
+		// Panic has been logged by the recovery filter.
+		errMsg = NewServerError(fmt.Sprintf(
+			"error processing your request (ID %s)", v.ID))
 	default:
 		// Unknown error type, treat it as a server error
-		id := rand.Int63()
-		logger().Errorf("error handling request %s (ID %016x): %v", r.URL.Path, id, err)
+		id := requestid.FromRequest(r)
+		if id == "" {
+			id = fmt.Sprintf("%016x", rand.Int63())
+		}
+		logger().Errorf("error handling request %s (ID %s): %v", r.URL.Path, id, err)
+		if h.reporter != nil {
+			h.reporter.ReportError(&core.ErrorReport{
+				Source:    "views",
+				Err:       err,
+				Request:   r,
+				RequestID: id,
+			})
+		}
 		errMsg = NewServerError(fmt.Sprintf(
-			"error processing your request (ID %016x)", id))
+			"error processing your request (ID %s)", id))
+	}
+	if data == nil {
+		data = errMsg
 	}
 	// Use provider to writes error when possible
 	if ctx := fromContext(r.Context()); ctx != nil {
-		writer, contentType := ctx.findWriter(w, r, errMsg)
+		writer, contentType := ctx.findWriter(w, r, data)
 		if writer != nil {
 			if contentType != "" {
 				w.Header().Set("Content-Type", contentType)
 			}
 			w.WriteHeader(errMsg.Code)
-			err = writer.WriteResponse(w, r, errMsg)
+			err = writer.WriteResponse(w, r, data)
 			if err != nil {
 				logger().Errorf("response writer: %v", err)
 			}
@@ -0,0 +1,49 @@
+package views
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/goburrow/melon/server/recovery"
+	"github.com/goburrow/melon/server/requestid"
+	"github.com/goburrow/melon/server/router"
+)
+
+func TestErrorMapperWithRequestID(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), "abc"))
+
+	newErrorMapper(nil).MapError(w, r, errors.New("unknown"))
+	if http.StatusInternalServerError != w.Code {
+		t.Fatalf("unexpected status code: %v", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "(ID abc)") {
+		t.Fatalf("unexpected body: %v", w.Body.String())
+	}
+}
+
+func TestErrorMapperPanic(t *testing.T) {
+	rt := router.New()
+	rt.AddFilter(recovery.NewFilter())
+	h := newResourceHandler(rt, nil)
+	h.HandleResource(NewJSONProvider())
+	h.HandleResource(NewResource("GET", "/", HandlerFunc(func(r *http.Request) (interface{}, error) {
+		panic("panic")
+	})))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	r = r.WithContext(requestid.NewContext(r.Context(), "abc"))
+	rt.ServeHTTP(w, r)
+	if http.StatusInternalServerError != w.Code {
+		t.Fatalf("unexpected status code: %v", w.Code)
+	}
+	if w.Header().Get("Content-Type") != "application/json" || !strings.Contains(w.Body.String(), "(ID abc)") {
+		t.Fatalf("unexpected response: %v %v", w.Header(), w.Body.String())
+	}
+}
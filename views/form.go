@@ -0,0 +1,127 @@
+package views
+
+import (
+	"mime/multipart"
+	"net/http"
+	"reflect"
+
+	"github.com/goburrow/melon/server/body"
+)
+
+// defaultMaxMemory is the default maximum number of bytes of multipart forms
+// stored in memory, which is the same as net/http.
+const defaultMaxMemory = 32 << 20
+
+var formMediaTypes = []string{
+	"application/x-www-form-urlencoded",
+	"multipart/form-data",
+}
+
+// formReader binds form data to structs.
+type formReader struct {
+	maxMemory int64
+}
+
+// NewFormReader returns a RequestReader which binds URL-encoded and multipart
+// forms to struct fields tagged with `form:"name"`, for example:
+//
+//	type Signup struct {
+//		Name    string                `form:"name"`
+//		Tags    []string              `form:"tags"`
+//		Country string                `form:"country" default:"VN"`
+//		Address struct {
+//			City string `form:"city"` // address.city
+//		} `form:"address"`
+//		Avatar *multipart.FileHeader `form:"avatar"`
+//	}
+//
+// Parts of multipart forms exceeding maxMemory bytes (default 32MiB) are
+// stored in temporary files, which are removed after the request is handled.
+// Size of request bodies can be limited with WithMaxBodySize.
+// The reader has PriorityUser so that it is used instead of the HTML provider.
+func NewFormReader(maxMemory int64) RequestReader {
+	if maxMemory <= 0 {
+		maxMemory = defaultMaxMemory
+	}
+	return &formReader{
+		maxMemory: maxMemory,
+	}
+}
+
+// Priority returns PriorityUser.
+func (p *formReader) Priority() int {
+	return PriorityUser
+}
+
+// Consumes returns form media types.
+func (p *formReader) Consumes() []string {
+	return formMediaTypes
+}
+
+// IsReadable returns true if v is a pointer to struct.
+func (p *formReader) IsReadable(r *http.Request, v interface{}) bool {
+	return isStructPointer(v)
+}
+
+// ReadRequest parses form data and binds it to v. Invalid fields are
+// reported in a FieldErrorMessage.
+func (p *formReader) ReadRequest(r *http.Request, v interface{}) error {
+	if err := parseForm(r, p.maxMemory); err != nil {
+		return err
+	}
+	if r.MultipartForm != nil {
+		if ctx := fromContext(r.Context()); ctx != nil {
+			ctx.addForm(r.MultipartForm)
+		}
+	}
+	b := binder{
+		sources: []bindSource{formSource(r)},
+	}
+	if err := b.bind(v); err != nil {
+		return err
+	}
+	return b.err("invalid form data")
+}
+
+// parseForm parses URL-encoded or multipart form in the request body.
+func parseForm(r *http.Request, maxMemory int64) error {
+	var err error
+	if baseMediaType(r.Header.Get("Content-Type")) == "multipart/form-data" {
+		err = r.ParseMultipartForm(maxMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		if body.IsTooLarge(r, err) {
+			return body.ErrTooLarge
+		}
+		return NewBadRequest("invalid form data: " + err.Error())
+	}
+	return nil
+}
+
+// formSource returns values and files in the form of the parsed request.
+func formSource(r *http.Request) bindSource {
+	s := bindSource{
+		tag: "form",
+		values: func(name string) ([]string, bool) {
+			values, ok := r.PostForm[name]
+			return values, ok
+		},
+	}
+	if r.MultipartForm != nil {
+		s.values = func(name string) ([]string, bool) {
+			values, ok := r.MultipartForm.Value[name]
+			return values, ok
+		}
+		s.files = func(name string) []*multipart.FileHeader {
+			return r.MultipartForm.File[name]
+		}
+	}
+	return s
+}
+
+func isStructPointer(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	return t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct
+}
@@ -0,0 +1,243 @@
+package views
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/server/router"
+)
+
+type formAddress struct {
+	City string `form:"city"`
+}
+
+type formEmbedded struct {
+	Note string `form:"note"`
+}
+
+type testForm struct {
+	formEmbedded
+	Name     string        `form:"name"`
+	Age      int           `form:"age"`
+	Tags     []string      `form:"tags"`
+	Country  string        `form:"country" default:"VN"`
+	Timeout  time.Duration `form:"timeout"`
+	Birthday *time.Time    `form:"birthday"`
+	Address  formAddress   `form:"address"`
+	Ignored  string        `form:"-"`
+
+	Avatar *multipart.FileHeader   `form:"avatar"`
+	Files  []*multipart.FileHeader `form:"files"`
+}
+
+type nameValidator struct{}
+
+func (nameValidator) Validate(v interface{}) error {
+	if f, ok := v.(*testForm); ok && f.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func newFormRouter(result *testForm) *router.Router {
+	rt := router.New()
+	h := newResourceHandler(rt, nameValidator{})
+	h.HandleResource(NewJSONProvider())
+	h.HandleResource(NewFormReader(0))
+	h.HandleResource(NewResource("POST", "/", HandlerFunc(func(r *http.Request) (interface{}, error) {
+		var f testForm
+		if err := Entity(r, &f); err != nil {
+			return nil, err
+		}
+		if f.Avatar != nil {
+			file, err := f.Avatar.Open()
+			if err != nil {
+				return nil, err
+			}
+			b, _ := ioutil.ReadAll(file)
+			file.Close()
+			f.Ignored = string(b)
+		}
+		*result = f
+		return "ok", nil
+	})))
+	return rt
+}
+
+func TestFormURLEncoded(t *testing.T) {
+	var f testForm
+	rt := newFormRouter(&f)
+
+	form := "name=melon&age=3&tags=a&tags=b&timeout=1s&birthday=2015-01-14T00:00:00Z&address.city=Saigon&note=hi&Ignored=x"
+	r := httptest.NewRequest("POST", "/", strings.NewReader(form))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+	birthday := time.Date(2015, time.January, 14, 0, 0, 0, 0, time.UTC)
+	expected := testForm{
+		formEmbedded: formEmbedded{"hi"},
+		Name:         "melon",
+		Age:          3,
+		Tags:         []string{"a", "b"},
+		Country:      "VN",
+		Timeout:      time.Second,
+		Birthday:     &birthday,
+		Address:      formAddress{"Saigon"},
+	}
+	if !reflect.DeepEqual(expected, f) {
+		t.Fatalf("unexpected form: %+v, want: %+v", f, expected)
+	}
+}
+
+func TestFormInvalid(t *testing.T) {
+	var f testForm
+	rt := newFormRouter(&f)
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("name=melon&age=x&timeout=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+	var msg FieldErrorMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	expected := []ErrorDetail{
+		{"age", `not a valid integer: "x"`},
+		{"timeout", `not a valid duration: "1"`},
+	}
+	if msg.Code != http.StatusBadRequest || !reflect.DeepEqual(expected, msg.Details) {
+		t.Fatalf("unexpected error: %+v", msg)
+	}
+	// Validation
+	r = httptest.NewRequest("POST", "/", strings.NewReader("age=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "name is required") {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFormMultipart(t *testing.T) {
+	var f testForm
+	rt := newFormRouter(&f)
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("name", "melon")
+	mw.WriteField("tags", "a")
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write([]byte("image"))
+	mw.CreateFormFile("files", "1.txt")
+	mw.CreateFormFile("files", "2.txt")
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/", &buf)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+	if f.Name != "melon" || len(f.Tags) != 1 || f.Avatar == nil || f.Avatar.Filename != "avatar.png" || f.Ignored != "image" {
+		t.Fatalf("unexpected form: %+v", f)
+	}
+	if len(f.Files) != 2 || f.Files[1].Filename != "2.txt" {
+		t.Fatalf("unexpected files: %+v", f.Files)
+	}
+}
+
+func TestFormMultipartRemoveAll(t *testing.T) {
+	var name string
+	rt := router.New()
+	h := newResourceHandler(rt, nil)
+	h.HandleResource(NewFormReader(1))
+	h.HandleResource(NewJSONProvider())
+	h.HandleResource(NewResource("POST", "/", HandlerFunc(func(r *http.Request) (interface{}, error) {
+		// Form is parsed in a request derived from the one given to handler.
+		r = r.WithContext(r.Context())
+		var f testForm
+		if err := Entity(r, &f); err != nil {
+			return nil, err
+		}
+		file, err := f.Avatar.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		osFile, ok := file.(*os.File)
+		if !ok {
+			return nil, errors.New("avatar is not stored in file")
+		}
+		name = osFile.Name()
+		return "ok", nil
+	})))
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("name", "melon")
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write([]byte("image"))
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/", &buf)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatalf("temporary file %s is not removed: %v", name, err)
+	}
+}
+
+func TestFormMultipartTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("name", "melon")
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write(bytes.Repeat([]byte("image"), 1000))
+	mw.Close()
+
+	// Limits exceeded in the middle of part boundaries, headers and content.
+	for _, limit := range []int64{20, 300, 1000} {
+		rt := router.New()
+		h := newResourceHandler(rt, nil)
+		h.HandleResource(NewFormReader(0))
+		h.HandleResource(NewJSONProvider())
+		h.HandleResource(NewResource("POST", "/", HandlerFunc(func(r *http.Request) (interface{}, error) {
+			var f testForm
+			if err := Entity(r, &f); err != nil {
+				return nil, err
+			}
+			return "ok", nil
+		}), WithMaxBodySize(limit)))
+
+		r := httptest.NewRequest("POST", "/", bytes.NewReader(buf.Bytes()))
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		r.ContentLength = -1
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, r)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("unexpected response for limit %d: %v %s", limit, w.Code, w.Body.String())
+		}
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"io"
 	"net/http"
 	"path/filepath"
+	"sync"
+
+	"github.com/goburrow/melon/server/security"
 )
 
 var htmlMediaTypes = []string{
@@ -14,16 +17,19 @@ var htmlMediaTypes = []string{
 	"multipart/form-data",
 }
 
-// NewHTMLProvider returns a Provider which writes HTML.
+// NewHTMLProvider returns a Provider which writes HTML and binds form data
+// as NewFormReader does.
 func NewHTMLProvider(renderer HTMLRenderer) Provider {
 	return &htmlProvider{
 		renderer: renderer,
+		form:     formReader{maxMemory: defaultMaxMemory},
 	}
 }
 
 // htmlProvider writes HTML to HTTP response.
 type htmlProvider struct {
 	renderer HTMLRenderer
+	form     formReader
 }
 
 // Consumes returns html media types.
@@ -36,10 +42,13 @@ func (p *htmlProvider) IsReadable(*http.Request, interface{}) bool {
 	return true
 }
 
-// ReadRequest does nothing. Use http.Request.ParseForm to reads form data.
-func (p *htmlProvider) ReadRequest(*http.Request, interface{}) error {
-	// Do nothing
-	return nil
+// ReadRequest binds form data to v if it is a pointer to struct. Otherwise,
+// it only parses the form, which can be read from http.Request.Form.
+func (p *htmlProvider) ReadRequest(r *http.Request, v interface{}) error {
+	if isStructPointer(v) {
+		return p.form.ReadRequest(r, v)
+	}
+	return parseForm(r, p.form.maxMemory)
 }
 
 // Produces returns html media types.
@@ -59,6 +68,9 @@ func (p *htmlProvider) WriteResponse(w http.ResponseWriter, r *http.Request, v i
 	if ctx == nil || ctx.handler.htmlTemplate == "" {
 		return fmt.Errorf("melon/views: unsupported context: %#v", r.Context())
 	}
+	if renderer, ok := p.renderer.(HTMLRequestRenderer); ok {
+		return renderer.RenderHTMLRequest(w, r, ctx.handler.htmlTemplate, v)
+	}
 	return p.renderer.RenderHTML(w, ctx.handler.htmlTemplate, v)
 }
 
@@ -74,19 +86,86 @@ type HTMLRenderer interface {
 	RenderHTML(w io.Writer, name string, data interface{}) error
 }
 
+// HTMLRequestRenderer is a HTMLRenderer which also renders html with
+// the request, e.g. to include its Content-Security-Policy nonce.
+type HTMLRequestRenderer interface {
+	HTMLRenderer
+	RenderHTMLRequest(w io.Writer, r *http.Request, name string, data interface{}) error
+}
+
 // NewHTMLRenderer returns a HTMLRenderer which takes templates from
 // files which pattern pat in directory dir.
+// Templates can use function cspNonce to get the nonce of Content-Security-Policy
+// set by security filter:
+//
+//	<script nonce="{{cspNonce}}">...</script>
 func NewHTMLRenderer(dir, pat string) (HTMLRenderer, error) {
 	glob := filepath.Join(dir, pat)
-	tpl, err := template.ParseGlob(glob)
+	tpl, err := template.New("").Funcs(template.FuncMap{
+		"cspNonce": func() string { return "" },
+	}).ParseGlob(glob)
 	if err != nil {
 		return nil, err
 	}
-	return rendererFunc(tpl.ExecuteTemplate), nil
+	// Templates can not be cloned after executed.
+	exec, err := tpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return &htmlRenderer{
+		tpl:  tpl,
+		exec: exec,
+	}, nil
+}
+
+// htmlRenderer renders html templates. tpl is never executed so that it can be
+// cloned for rendering requests having CSP nonce.
+type htmlRenderer struct {
+	tpl  *template.Template
+	exec *template.Template
+	// nonceTemplates is a pool of *nonceTemplate.
+	nonceTemplates sync.Pool
+}
+
+// nonceTemplate is a clone of templates which function cspNonce returns
+// nonce of the request being rendered. It is reused by requests so that
+// templates are only cloned when all clones are in use.
+type nonceTemplate struct {
+	tpl   *template.Template
+	nonce string
 }
 
-type rendererFunc func(w io.Writer, name string, data interface{}) error
+func (h *htmlRenderer) RenderHTML(w io.Writer, name string, data interface{}) error {
+	return h.exec.ExecuteTemplate(w, name, data)
+}
 
-func (f rendererFunc) RenderHTML(w io.Writer, name string, data interface{}) error {
-	return f(w, name, data)
+func (h *htmlRenderer) RenderHTMLRequest(w io.Writer, r *http.Request, name string, data interface{}) error {
+	nonce := security.Nonce(r)
+	if nonce == "" {
+		return h.exec.ExecuteTemplate(w, name, data)
+	}
+	t, err := h.getNonceTemplate()
+	if err != nil {
+		return err
+	}
+	t.nonce = nonce
+	err = t.tpl.ExecuteTemplate(w, name, data)
+	t.nonce = ""
+	h.nonceTemplates.Put(t)
+	return err
+}
+
+func (h *htmlRenderer) getNonceTemplate() (*nonceTemplate, error) {
+	if t, ok := h.nonceTemplates.Get().(*nonceTemplate); ok {
+		return t, nil
+	}
+	tpl, err := h.tpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t := &nonceTemplate{}
+	t.tpl = tpl.Funcs(template.FuncMap{
+		"cspNonce": func() string { return t.nonce },
+	})
+	return t, nil
 }
@@ -0,0 +1,56 @@
+package views
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goburrow/melon/server/router"
+	"github.com/goburrow/melon/server/security"
+)
+
+func TestHTMLRendererNonce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "melon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(`<script nonce="{{cspNonce}}">{{.}}</script>`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderer, err := NewHTMLRenderer(dir, "*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = renderer.RenderHTML(&buf, "index.html", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if `<script nonce="">"a"</script>` != buf.String() {
+		t.Fatalf("unexpected html: %s", buf.String())
+	}
+
+	var nonce string
+	rt := router.New()
+	rt.AddFilter(security.NewFilter(security.WithContentSecurityPolicy("script-src 'nonce-{nonce}'")))
+	h := newResourceHandler(rt, nil)
+	h.HandleResource(NewHTMLProvider(renderer))
+	h.HandleResource(NewResource("GET", "/", HandlerFunc(func(r *http.Request) (interface{}, error) {
+		nonce = security.Nonce(r)
+		return "b", nil
+	}), WithHTMLTemplate("index.html")))
+
+	// Templates are reused for the next request.
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if `<script nonce="`+nonce+`">"b"</script>` != w.Body.String() {
+			t.Fatalf("unexpected html for nonce %s: %s", nonce, w.Body.String())
+		}
+	}
+}
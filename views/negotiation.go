@@ -0,0 +1,142 @@
+package views
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mediaRange is a media range in Accept header.
+type mediaRange struct {
+	typ     string
+	subtype string
+	// params are media type parameters except q.
+	params map[string]string
+	q      float64
+	// index is the position in Accept header.
+	index int
+}
+
+// parseAccept parses media ranges in Accept header. Invalid media ranges are
+// ignored.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for i, s := range strings.Split(accept, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(s)
+		if err != nil {
+			continue
+		}
+		r := mediaRange{
+			q:     1,
+			index: i,
+		}
+		r.typ, r.subtype = splitMediaType(mediaType)
+		if r.typ == "*" && r.subtype != "*" {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			v, err := strconv.ParseFloat(q, 64)
+			if err != nil || v < 0 || v > 1 {
+				v = 0
+			}
+			r.q = v
+			delete(params, "q")
+		}
+		if len(params) > 0 {
+			r.params = params
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// match returns how specific the media range matches the media type, or -1
+// if it does not match. Parameters of the media range must match those of
+// the media type if they are present in the media type.
+func (r *mediaRange) match(typ, subtype string, params map[string]string) int {
+	specificity := 0
+	if r.typ != "*" {
+		if r.typ != typ {
+			return -1
+		}
+		specificity++
+	}
+	if r.subtype != "*" {
+		if r.subtype != subtype {
+			return -1
+		}
+		specificity++
+	}
+	for k, v := range r.params {
+		if p, ok := params[k]; ok && !strings.EqualFold(p, v) {
+			return -1
+		}
+		specificity++
+	}
+	return specificity
+}
+
+// negotiate returns media types in the given list which are acceptable
+// according to Accept header, ordered by quality value and then by the
+// position of the media range in Accept header. Media types with the same
+// preference keep their order in the list.
+// See https://tools.ietf.org/html/rfc7231#section-5.3.2
+func negotiate(accept string, mediaTypes []string) []string {
+	ranges := parseAccept(accept)
+	type candidate struct {
+		mediaType string
+		q         float64
+		index     int
+	}
+	candidates := make([]candidate, 0, len(mediaTypes))
+	for _, m := range mediaTypes {
+		mediaType, params, err := mime.ParseMediaType(m)
+		if err != nil {
+			continue
+		}
+		typ, subtype := splitMediaType(mediaType)
+		// The most specific media range decides quality of the media type.
+		var best *mediaRange
+		bestSpecificity := -1
+		for i := range ranges {
+			if s := ranges[i].match(typ, subtype, params); s > bestSpecificity {
+				best = &ranges[i]
+				bestSpecificity = s
+			}
+		}
+		if best != nil && best.q > 0 {
+			candidates = append(candidates, candidate{m, best.q, best.index})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].q != candidates[j].q {
+			return candidates[i].q > candidates[j].q
+		}
+		return candidates[i].index < candidates[j].index
+	})
+	accepted := make([]string, len(candidates))
+	for i := range candidates {
+		accepted[i] = candidates[i].mediaType
+	}
+	return accepted
+}
+
+// baseMediaType returns the media type without parameters in lower case.
+func baseMediaType(s string) string {
+	if i := strings.Index(s, ";"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func splitMediaType(mediaType string) (string, string) {
+	if i := strings.Index(mediaType, "/"); i >= 0 {
+		return mediaType[:i], mediaType[i+1:]
+	}
+	return mediaType, ""
+}
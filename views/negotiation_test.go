@@ -0,0 +1,81 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goburrow/melon/server/router"
+)
+
+func TestNegotiate(t *testing.T) {
+	mediaTypes := []string{"application/json", "text/json", "application/xml", "text/html; level=1"}
+	tests := []struct {
+		accept   string
+		expected []string
+	}{
+		{"application/json", []string{"application/json"}},
+		{"application/xml, application/json", []string{"application/xml", "application/json"}},
+		{"application/json;q=0.5, application/xml", []string{"application/xml", "application/json"}},
+		{"application/*", []string{"application/json", "application/xml"}},
+		{"*/*;q=0.1, text/json", []string{"text/json", "application/json", "application/xml", "text/html; level=1"}},
+		{"application/*, application/xml;q=0", []string{"application/json"}},
+		{"application/json; charset=utf-8", []string{"application/json"}},
+		{"text/html;level=2", nil},
+		{"text/html;level=1, text/*;q=0.5", []string{"text/html; level=1", "text/json"}},
+		{"APPLICATION/JSON;Q=0.9", []string{"application/json"}},
+		{"image/png", nil},
+		{"invalid, */json", nil},
+	}
+	for _, test := range tests {
+		accepted := negotiate(test.accept, mediaTypes)
+		if len(test.expected) != len(accepted) || (len(accepted) > 0 && !reflect.DeepEqual(test.expected, accepted)) {
+			t.Errorf("unexpected media types for %q: %#v, want: %#v", test.accept, accepted, test.expected)
+		}
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	rt := router.New()
+	h := newResourceHandler(rt, nil)
+	h.HandleResource(NewJSONProvider())
+	h.HandleResource(NewXMLProvider())
+	h.HandleResource(NewResource("POST", "/", HandlerFunc(func(r *http.Request) (interface{}, error) {
+		var v string
+		if err := Entity(r, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	})))
+
+	tests := []struct {
+		contentType string
+		accept      string
+		status      int
+		expected    string
+	}{
+		{"application/json; charset=utf-8", "", http.StatusOK, "application/json"},
+		{"Application/JSON", "application/*", http.StatusOK, "application/json"},
+		{"application/json", "application/json;q=0.5, text/xml", http.StatusOK, "text/xml"},
+		{"application/json", "image/png", http.StatusNotAcceptable, ""},
+		{"image/png", "application/json", http.StatusUnsupportedMediaType, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`"a"`))
+		r.Header.Set("Content-Type", test.contentType)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, r)
+		if test.status != w.Code {
+			t.Fatalf("unexpected status code for %+v: %v %s", test, w.Code, w.Body.String())
+		}
+		if test.expected != "" && test.expected != w.Header().Get("Content-Type") {
+			t.Fatalf("unexpected content type for %+v: %v", test, w.Header())
+		}
+		if "Accept" != w.Header().Get("Vary") {
+			t.Fatalf("unexpected vary header for %+v: %v", test, w.Header())
+		}
+	}
+}
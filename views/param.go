@@ -0,0 +1,165 @@
+package views
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/goburrow/melon/server/router"
+)
+
+// Param is a value of path or query parameter in the request.
+// Its conversion methods return ErrorMessage with status code
+// http.StatusBadRequest when value is missing or invalid.
+type Param struct {
+	source string
+	name   string
+	value  string
+	exists bool
+}
+
+// PathParam returns path parameter with the given name.
+func PathParam(r *http.Request, name string) Param {
+	value, ok := router.PathParams(r)[name]
+	return Param{
+		source: "path",
+		name:   name,
+		value:  value,
+		exists: ok,
+	}
+}
+
+// QueryParam returns the first value of query parameter with the given name.
+func QueryParam(r *http.Request, name string) Param {
+	values, ok := r.URL.Query()[name]
+	p := Param{
+		source: "query",
+		name:   name,
+		exists: ok,
+	}
+	if len(values) > 0 {
+		p.value = values[0]
+	}
+	return p
+}
+
+// Exists returns true if the parameter is set in the request.
+func (p Param) Exists() bool {
+	return p.exists
+}
+
+// String returns raw value of the parameter.
+func (p Param) String() string {
+	return p.value
+}
+
+// Int returns parameter value as an int.
+func (p Param) Int() (int, error) {
+	var v int
+	err := p.convert(&v)
+	return v, err
+}
+
+// Int64 returns parameter value as an int64.
+func (p Param) Int64() (int64, error) {
+	var v int64
+	err := p.convert(&v)
+	return v, err
+}
+
+// Uint64 returns parameter value as an uint64.
+func (p Param) Uint64() (uint64, error) {
+	var v uint64
+	err := p.convert(&v)
+	return v, err
+}
+
+// Float64 returns parameter value as a float64.
+func (p Param) Float64() (float64, error) {
+	var v float64
+	err := p.convert(&v)
+	return v, err
+}
+
+// Bool returns parameter value as a bool.
+func (p Param) Bool() (bool, error) {
+	var v bool
+	err := p.convert(&v)
+	return v, err
+}
+
+// UUID validates parameter value is an UUID and returns it in lower case.
+func (p Param) UUID() (string, error) {
+	if err := p.required(); err != nil {
+		return "", err
+	}
+	if !isUUID(p.value) {
+		return "", p.invalid(invalidValue("UUID", p.value))
+	}
+	return strings.ToLower(p.value), nil
+}
+
+// Time returns parameter value as a time.Time parsed with the given layout.
+func (p Param) Time(layout string) (time.Time, error) {
+	if err := p.required(); err != nil {
+		return time.Time{}, err
+	}
+	v, err := time.Parse(layout, p.value)
+	if err != nil {
+		return time.Time{}, p.invalid(invalidValue("time", p.value))
+	}
+	return v, nil
+}
+
+// Duration returns parameter value as a time.Duration.
+func (p Param) Duration() (time.Duration, error) {
+	var v time.Duration
+	err := p.convert(&v)
+	return v, err
+}
+
+// convert sets v, a pointer, to the parameter value converted the same way
+// as struct fields bound by Params.
+func (p Param) convert(v interface{}) error {
+	if err := p.required(); err != nil {
+		return err
+	}
+	if err := setValue(reflect.ValueOf(v).Elem(), p.value); err != nil {
+		return p.invalid(err)
+	}
+	return nil
+}
+
+func (p Param) required() error {
+	if p.value == "" {
+		return NewBadRequest(fmt.Sprintf("%s parameter %s is required", p.source, p.name))
+	}
+	return nil
+}
+
+func (p Param) invalid(err error) error {
+	return NewBadRequest(fmt.Sprintf("%s parameter %s is %v", p.source, p.name, err))
+}
+
+// isUUID checks if s is in form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
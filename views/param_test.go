@@ -0,0 +1,79 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/server/router"
+)
+
+func TestPathParam(t *testing.T) {
+	var id int64
+	var uuid string
+	var err error
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		id, err = PathParam(r, "id").Int64()
+		if err != nil {
+			return
+		}
+		uuid, err = PathParam(r, "uuid").UUID()
+	}
+	rt := router.New()
+	rt.Handle("GET", "/{id}/{uuid}", http.HandlerFunc(handler))
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/12/123E4567-E89B-12D3-A456-426655440000", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if 12 != id || "123e4567-e89b-12d3-a456-426655440000" != uuid {
+		t.Fatalf("unexpected params: %v %v", id, uuid)
+	}
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a/123e4567", nil))
+	errMsg, ok := err.(*ErrorMessage)
+	if !ok || http.StatusBadRequest != errMsg.Code {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/1/123e4567", nil))
+	errMsg, ok = err.(*ErrorMessage)
+	if !ok || http.StatusBadRequest != errMsg.Code {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+}
+
+func TestQueryParam(t *testing.T) {
+	r := httptest.NewRequest("GET", "/?limit=10&since=2017-01-02&active=true&timeout=1s&x=", nil)
+
+	limit, err := QueryParam(r, "limit").Int()
+	if err != nil || 10 != limit {
+		t.Fatalf("unexpected limit: %v %v", limit, err)
+	}
+	since, err := QueryParam(r, "since").Time("2006-01-02")
+	if err != nil || !since.Equal(time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected since: %v %v", since, err)
+	}
+	active, err := QueryParam(r, "active").Bool()
+	if err != nil || !active {
+		t.Fatalf("unexpected active: %v %v", active, err)
+	}
+	timeout, err := QueryParam(r, "timeout").Duration()
+	if err != nil || time.Second != timeout {
+		t.Fatalf("unexpected timeout: %v %v", timeout, err)
+	}
+	p := QueryParam(r, "x")
+	if !p.Exists() {
+		t.Fatalf("parameter must exist: %#v", p)
+	}
+	if _, err = p.Float64(); err == nil {
+		t.Fatal("error expected")
+	}
+	if QueryParam(r, "y").Exists() {
+		t.Fatal("parameter must not exist")
+	}
+	_, err = QueryParam(r, "since").Int64()
+	if err == nil || err.Error() != `query parameter since is not a valid integer: "2017-01-02"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
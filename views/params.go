@@ -0,0 +1,127 @@
+package views
+
+import (
+	"net/http"
+
+	"github.com/goburrow/melon/server/router"
+)
+
+// Params binds path, query, header and cookie values of the request to
+// fields of struct v tagged with `path`, `query`, `header` or `cookie`
+// respectively, for example:
+//
+//	type ListParams struct {
+//		ID      int64         `path:"id"`
+//		Tags    []string      `query:"tag"`
+//		Limit   int           `query:"limit" default:"10"`
+//		Timeout time.Duration `header:"X-Timeout"`
+//		Session string        `cookie:"session"`
+//	}
+//
+// Values are converted the same way as form values, see NewFormReader.
+// All invalid fields are reported in a single FieldErrorMessage with status
+// code http.StatusBadRequest. The struct is then validated by the validator
+// of the views bundle when the request is served by a resource, use
+// BindParams instead if the struct is also read by Entity. Validation errors
+// of fields, which have method Field() returning the Go field name, are
+// reported the same way.
+func Params(r *http.Request, v interface{}) error {
+	b := newParamsBinder(r)
+	if err := b.bind(v); err != nil {
+		return err
+	}
+	if err := b.err(paramsErrorMessage); err != nil {
+		return err
+	}
+	if ctx := fromContext(r.Context()); ctx != nil && ctx.handler.validator != nil {
+		if err := ctx.handler.validator.Validate(v); err != nil {
+			if b.addValidationErrors(v, err) {
+				return b.err(paramsErrorMessage)
+			}
+			return &ErrorMessage{http.StatusBadRequest, err.Error()}
+		}
+	}
+	return nil
+}
+
+// BindParams binds request parameters to v like Params but does not
+// validate it. It is used for structs which also have fields read from
+// the request body, so that they are validated once by Entity:
+//
+//	var req UpdateUserRequest // with `path:"id"` and `json:"name"` fields
+//	if err := views.BindParams(r, &req); err != nil {
+//		return nil, err
+//	}
+//	if err := views.Entity(r, &req); err != nil {
+//		return nil, err
+//	}
+func BindParams(r *http.Request, v interface{}) error {
+	b := newParamsBinder(r)
+	if err := b.bind(v); err != nil {
+		return err
+	}
+	return b.err(paramsErrorMessage)
+}
+
+const paramsErrorMessage = "invalid request parameters"
+
+func newParamsBinder(r *http.Request) *binder {
+	return &binder{
+		sources: []bindSource{
+			pathSource(r),
+			querySource(r),
+			headerSource(r),
+			cookieSource(r),
+		},
+	}
+}
+
+func pathSource(r *http.Request) bindSource {
+	params := router.PathParams(r)
+	return bindSource{
+		tag: "path",
+		values: func(name string) ([]string, bool) {
+			value, ok := params[name]
+			if !ok {
+				return nil, false
+			}
+			return []string{value}, true
+		},
+	}
+}
+
+func querySource(r *http.Request) bindSource {
+	query := r.URL.Query()
+	return bindSource{
+		tag: "query",
+		values: func(name string) ([]string, bool) {
+			values, ok := query[name]
+			return values, ok
+		},
+	}
+}
+
+func headerSource(r *http.Request) bindSource {
+	return bindSource{
+		tag: "header",
+		values: func(name string) ([]string, bool) {
+			values, ok := r.Header[http.CanonicalHeaderKey(name)]
+			return values, ok
+		},
+	}
+}
+
+func cookieSource(r *http.Request) bindSource {
+	return bindSource{
+		tag: "cookie",
+		values: func(name string) ([]string, bool) {
+			var values []string
+			for _, c := range r.Cookies() {
+				if c.Name == name {
+					values = append(values, c.Value)
+				}
+			}
+			return values, len(values) > 0
+		},
+	}
+}
@@ -0,0 +1,195 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goburrow/melon/server/router"
+)
+
+type testParams struct {
+	ID      int64         `path:"id"`
+	Tags    []string      `query:"tag"`
+	Limit   int           `query:"limit" default:"10"`
+	Timeout time.Duration `header:"x-timeout"`
+	Session string        `cookie:"session"`
+	Page    struct {
+		Size int `query:"size"`
+	} `query:"page"`
+}
+
+type testFieldError struct {
+	field   string
+	message string
+}
+
+func (e *testFieldError) Field() string {
+	return e.field
+}
+
+func (e *testFieldError) Error() string {
+	return e.message
+}
+
+type testErrors []error
+
+func (e testErrors) Error() string {
+	return fmt.Sprint([]error(e))
+}
+
+type limitValidator struct{}
+
+func (limitValidator) Validate(v interface{}) error {
+	p, ok := v.(*testParams)
+	if !ok {
+		return nil
+	}
+	if p.Session == "bad" {
+		return errors.New("session is invalid")
+	}
+	var errs testErrors
+	if p.Limit > 100 {
+		errs = append(errs, &testFieldError{"Limit", "is too large"})
+	}
+	if p.Page.Size > 50 {
+		errs = append(errs, &testFieldError{"Page.Size", "is too large"})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func TestParams(t *testing.T) {
+	var p testParams
+	var err error
+	rt := router.New()
+	h := newResourceHandler(rt, limitValidator{})
+	h.HandleResource(NewJSONProvider())
+	h.HandleResource(NewResource("GET", "/{id}", HandlerFunc(func(r *http.Request) (interface{}, error) {
+		p = testParams{}
+		err = Params(r, &p)
+		if err != nil {
+			return nil, err
+		}
+		return "ok", nil
+	})))
+
+	r := httptest.NewRequest("GET", "/12?tag=a&tag=b&page.size=5", nil)
+	r.Header.Set("X-Timeout", "2s")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := testParams{
+		ID:      12,
+		Tags:    []string{"a", "b"},
+		Limit:   10,
+		Timeout: 2 * time.Second,
+		Session: "abc",
+	}
+	expected.Page.Size = 5
+	if !reflect.DeepEqual(expected, p) {
+		t.Fatalf("unexpected params: %+v, want: %+v", p, expected)
+	}
+
+	r = httptest.NewRequest("GET", "/x?limit=y", nil)
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+	var msg FieldErrorMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	details := []ErrorDetail{
+		{"id", `not a valid integer: "x"`},
+		{"limit", `not a valid integer: "y"`},
+	}
+	if msg.Message != "invalid request parameters" || !reflect.DeepEqual(details, msg.Details) {
+		t.Fatalf("unexpected error: %+v", msg)
+	}
+
+	r = httptest.NewRequest("GET", "/1?limit=1000&page.size=100", nil)
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+	msg = FieldErrorMessage{}
+	if err := json.Unmarshal(w.Body.Bytes(), &msg); err != nil {
+		t.Fatal(err)
+	}
+	details = []ErrorDetail{
+		{"limit", "is too large"},
+		{"page.size", "is too large"},
+	}
+	if msg.Message != "invalid request parameters" || !reflect.DeepEqual(details, msg.Details) {
+		t.Fatalf("unexpected error: %+v", msg)
+	}
+
+	r = httptest.NewRequest("GET", "/1", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "bad"})
+	w = httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "session is invalid") {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+}
+
+type updateParams struct {
+	ID   int64  `path:"id"`
+	Name string `json:"name"`
+}
+
+type countValidator struct {
+	count int
+}
+
+func (v *countValidator) Validate(i interface{}) error {
+	v.count++
+	if p, ok := i.(*updateParams); ok && p.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+func TestBindParams(t *testing.T) {
+	var p updateParams
+	validator := &countValidator{}
+	rt := router.New()
+	h := newResourceHandler(rt, validator)
+	h.HandleResource(NewJSONProvider())
+	h.HandleResource(NewResource("PUT", "/{id}", HandlerFunc(func(r *http.Request) (interface{}, error) {
+		if err := BindParams(r, &p); err != nil {
+			return nil, err
+		}
+		if err := Entity(r, &p); err != nil {
+			return nil, err
+		}
+		return "ok", nil
+	})))
+
+	r := httptest.NewRequest("PUT", "/12", strings.NewReader(`{"name":"melon"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected response: %v %s", w.Code, w.Body.String())
+	}
+	if p.ID != 12 || p.Name != "melon" || validator.count != 1 {
+		t.Fatalf("unexpected params: %+v, validated %d times", p, validator.count)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Package protobuf provides a views provider for Protocol Buffers.
+*/
+package protobuf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+
+	"github.com/goburrow/melon/views"
+	"github.com/golang/protobuf/proto"
+)
+
+var mediaTypes = []string{
+	"application/x-protobuf",
+	"application/vnd.google.protobuf",
+}
+
+var messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// provider handles Protocol Buffers requests and responses.
+type provider struct{}
+
+// NewProvider returns a Provider which reads and writes proto.Message.
+// A slice of messages, e.g. []*pb.User, is written as a stream of messages,
+// each prefixed with its length in varint encoding, which must not contain
+// nil messages, and a pointer to a slice
+// of messages is read from such a stream.
+// The provider only accepts messages so that it can be used together with
+// other providers, e.g. JSON, on the same resource.
+func NewProvider() views.Provider {
+	return &provider{}
+}
+
+// Consumes returns Protocol Buffers media types.
+func (p *provider) Consumes() []string {
+	return mediaTypes
+}
+
+// IsReadable returns true if v is a proto.Message or a pointer to a slice
+// of messages.
+func (p *provider) IsReadable(r *http.Request, v interface{}) bool {
+	if _, ok := v.(proto.Message); ok {
+		return true
+	}
+	t := reflect.TypeOf(v)
+	return t != nil && t.Kind() == reflect.Ptr && isMessageSlice(t.Elem()) &&
+		t.Elem().Elem().Kind() == reflect.Ptr
+}
+
+// ReadRequest decodes a message or a stream of messages from request body.
+func (p *provider) ReadRequest(r *http.Request, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(b, m)
+	}
+	return readStream(r.Body, reflect.ValueOf(v).Elem())
+}
+
+// Produces returns Protocol Buffers media types.
+func (p *provider) Produces() []string {
+	return mediaTypes
+}
+
+// IsWriteable returns true if v is a proto.Message or a slice of messages.
+func (p *provider) IsWriteable(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if _, ok := v.(proto.Message); ok {
+		return true
+	}
+	t := reflect.TypeOf(v)
+	return t != nil && isMessageSlice(t)
+}
+
+// WriteResponse encodes a message or a stream of messages and writes to w.
+func (p *provider) WriteResponse(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		b, err := proto.Marshal(m)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	return writeStream(w, reflect.ValueOf(v))
+}
+
+func isMessageSlice(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Implements(messageType)
+}
+
+// readStream appends length-delimited messages from r to slice s.
+func readStream(r io.Reader, s reflect.Value) error {
+	br := bufio.NewReader(r)
+	elemType := s.Type().Elem().Elem()
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		// Buffer grows with the actual data instead of the declared length.
+		var buf bytes.Buffer
+		if _, err = buf.ReadFrom(io.LimitReader(br, int64(n))); err != nil {
+			return err
+		}
+		if uint64(buf.Len()) != n {
+			return io.ErrUnexpectedEOF
+		}
+		m := reflect.New(elemType)
+		if err = proto.Unmarshal(buf.Bytes(), m.Interface().(proto.Message)); err != nil {
+			return err
+		}
+		s.Set(reflect.Append(s, m))
+	}
+}
+
+// writeStream writes messages in slice s, each is prefixed with its length.
+// Nil messages can not be encoded in the stream, so nothing is written when
+// s contains any.
+func writeStream(w io.Writer, s reflect.Value) error {
+	for i := 0; i < s.Len(); i++ {
+		e := s.Index(i)
+		if (e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface) && e.IsNil() {
+			return fmt.Errorf("melon/protobuf: nil message at index %d", i)
+		}
+	}
+	var size [binary.MaxVarintLen64]byte
+	for i := 0; i < s.Len(); i++ {
+		b, err := proto.Marshal(s.Index(i).Interface().(proto.Message))
+		if err != nil {
+			return err
+		}
+		n := binary.PutUvarint(size[:], uint64(len(b)))
+		if _, err = w.Write(size[:n]); err != nil {
+			return err
+		}
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
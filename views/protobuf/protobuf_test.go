@@ -0,0 +1,92 @@
+package protobuf
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// testMessage is a hand-written message which encodes its name as is.
+type testMessage struct {
+	Name string
+}
+
+func (m *testMessage) Reset()         { *m = testMessage{} }
+func (m *testMessage) String() string { return m.Name }
+func (*testMessage) ProtoMessage()    {}
+
+func (m *testMessage) Marshal() ([]byte, error) {
+	return []byte(m.Name), nil
+}
+
+func (m *testMessage) Unmarshal(b []byte) error {
+	m.Name = string(b)
+	return nil
+}
+
+func TestProvider(t *testing.T) {
+	p := NewProvider()
+	r := httptest.NewRequest("POST", "/", nil)
+	w := httptest.NewRecorder()
+
+	var m testMessage
+	var list []*testMessage
+	var s string
+	if !p.IsReadable(r, &m) || !p.IsReadable(r, &list) || p.IsReadable(r, &s) || p.IsReadable(r, list) {
+		t.Fatal("unexpected readable types")
+	}
+	if !p.IsWriteable(w, r, &m) || !p.IsWriteable(w, r, list) || p.IsWriteable(w, r, s) || p.IsWriteable(w, r, nil) {
+		t.Fatal("unexpected writeable types")
+	}
+
+	m.Name = "abc"
+	if err := p.WriteResponse(w, r, &m); err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("POST", "/", bytes.NewReader(w.Body.Bytes()))
+	var decoded testMessage
+	if err := p.ReadRequest(r, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if m != decoded {
+		t.Fatalf("unexpected message: %+v", decoded)
+	}
+}
+
+func TestStream(t *testing.T) {
+	p := NewProvider()
+	list := []*testMessage{{"a"}, {"bc"}}
+	w := httptest.NewRecorder()
+	if err := p.WriteResponse(w, nil, list); err != nil {
+		t.Fatal(err)
+	}
+	if "\x01a\x02bc" != w.Body.String() {
+		t.Fatalf("unexpected stream: %q", w.Body.String())
+	}
+	var decoded []*testMessage
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(w.Body.Bytes()))
+	if err := p.ReadRequest(r, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]*testMessage{{"a"}, {"bc"}}, decoded) {
+		t.Fatalf("unexpected messages: %+v", decoded)
+	}
+	r = httptest.NewRequest("POST", "/", bytes.NewReader([]byte("\x03ab")))
+	if err := p.ReadRequest(r, &decoded); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestStreamNilMessage(t *testing.T) {
+	p := NewProvider()
+	list := []*testMessage{{"a"}, nil}
+	w := httptest.NewRecorder()
+	err := p.WriteResponse(w, nil, list)
+	if err == nil || err.Error() != "melon/protobuf: nil message at index 1" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("unexpected stream: %q", w.Body.String())
+	}
+}
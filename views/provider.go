@@ -2,75 +2,140 @@ package views
 
 import "net/http"
 
-// requestReader reads entity from message body.
-type requestReader interface {
+// Priorities of providers. When multiple readers or writers support the same
+// media type, the one with lower priority is used first.
+const (
+	// PriorityUser is for application providers which override the
+	// default ones.
+	PriorityUser = 100
+	// PriorityDefault is priority of providers which do not implement
+	// Prioritized.
+	PriorityDefault = 500
+)
+
+// RequestReader reads entity from message body.
+// It can be registered to core.ServerEnvironment alone or as a Provider.
+type RequestReader interface {
 	// Consumes returns list of MIME types which this reader can read.
 	Consumes() []string
 
+	// IsReadable returns true if the reader can decode the request to v.
 	IsReadable(*http.Request, interface{}) bool
+	// ReadRequest decodes the request body to v.
 	ReadRequest(*http.Request, interface{}) error
 }
 
-// responseWriter writes entity to message body.
-type responseWriter interface {
+// ResponseWriter writes entity to message body.
+// It can be registered to core.ServerEnvironment alone or as a Provider.
+type ResponseWriter interface {
 	// Procudes returns list of MIME types which this writer can write.
 	Produces() []string
 
+	// IsWriteable returns true if the writer can encode v.
 	IsWriteable(http.ResponseWriter, *http.Request, interface{}) bool
+	// WriteResponse encodes v to the response body.
 	WriteResponse(http.ResponseWriter, *http.Request, interface{}) error
 }
 
 // Provider define reader and writer for particular MIME types.
 type Provider interface {
-	requestReader
-	responseWriter
+	RequestReader
+	ResponseWriter
+}
+
+// Prioritized is implemented by readers, writers and providers which declare
+// their priority.
+type Prioritized interface {
+	Priority() int
+}
+
+// priority returns priority of reader, writer or provider v.
+func priority(v interface{}) int {
+	if p, ok := v.(Prioritized); ok {
+		return p.Priority()
+	}
+	return PriorityDefault
 }
 
 // providers is used to look up providers by MIME type.
 // TODO: Error mapper.
 type providers interface {
-	GetRequestReaders(string) []requestReader
-	GetResponseWriters(string) []responseWriter
+	GetRequestReaders(string) []RequestReader
+	GetResponseWriters(string) []ResponseWriter
 }
 
 // providerMap associates media types with respective providers.
 type providerMap struct {
-	readers       []requestReader
-	readersByType map[string][]requestReader
+	readers       []RequestReader
+	readersByType map[string][]RequestReader
 
-	writers       []responseWriter
-	writersByType map[string][]responseWriter
+	writers       []ResponseWriter
+	writersByType map[string][]ResponseWriter
 }
 
 func newProviderMap() *providerMap {
 	return &providerMap{
-		readersByType: make(map[string][]requestReader),
-		writersByType: make(map[string][]responseWriter),
+		readersByType: make(map[string][]RequestReader),
+		writersByType: make(map[string][]ResponseWriter),
 	}
 }
 
 func (p *providerMap) AddProvider(provider Provider) {
-	p.addRequestReader(provider)
-	p.addResponseWriter(provider)
+	p.AddRequestReader(provider)
+	p.AddResponseWriter(provider)
 }
 
-func (p *providerMap) addRequestReader(reader requestReader) {
-	p.readers = append(p.readers, reader)
+// AddRequestReader adds reader after readers which have the same or lower
+// priority.
+func (p *providerMap) AddRequestReader(reader RequestReader) {
+	p.readers = insertRequestReader(p.readers, reader)
 	for _, m := range reader.Consumes() {
-		p.readersByType[m] = append(p.readersByType[m], reader)
+		p.readersByType[m] = insertRequestReader(p.readersByType[m], reader)
 	}
 }
 
-func (p *providerMap) addResponseWriter(writer responseWriter) {
-	p.writers = append(p.writers, writer)
+// AddResponseWriter adds writer after writers which have the same or lower
+// priority.
+func (p *providerMap) AddResponseWriter(writer ResponseWriter) {
+	p.writers = insertResponseWriter(p.writers, writer)
 	for _, m := range writer.Produces() {
-		p.writersByType[m] = append(p.writersByType[m], writer)
+		p.writersByType[m] = insertResponseWriter(p.writersByType[m], writer)
+	}
+}
+
+func insertRequestReader(readers []RequestReader, reader RequestReader) []RequestReader {
+	n := priority(reader)
+	idx := len(readers)
+	for i, r := range readers {
+		if priority(r) > n {
+			idx = i
+			break
+		}
+	}
+	readers = append(readers, nil)
+	copy(readers[idx+1:], readers[idx:])
+	readers[idx] = reader
+	return readers
+}
+
+func insertResponseWriter(writers []ResponseWriter, writer ResponseWriter) []ResponseWriter {
+	n := priority(writer)
+	idx := len(writers)
+	for i, w := range writers {
+		if priority(w) > n {
+			idx = i
+			break
+		}
 	}
+	writers = append(writers, nil)
+	copy(writers[idx+1:], writers[idx:])
+	writers[idx] = writer
+	return writers
 }
 
 // GetRequestReaders returns readers which can handle the given mime type.
 // All readers are returned if mime is wildcard.
-func (p *providerMap) GetRequestReaders(mime string) []requestReader {
+func (p *providerMap) GetRequestReaders(mime string) []RequestReader {
 	if isWildcard(mime) {
 		return p.readers
 	}
@@ -79,14 +144,14 @@ func (p *providerMap) GetRequestReaders(mime string) []requestReader {
 
 // GetRequestReaders returns writers which can handle the given mime type.
 // All writers are returned if mime is wildcard.
-func (p *providerMap) GetResponseWriters(mime string) []responseWriter {
+func (p *providerMap) GetResponseWriters(mime string) []ResponseWriter {
 	if isWildcard(mime) {
 		return p.writers
 	}
 	return p.writersByType[mime]
 }
 
-// explicitProviderMap returns only supported requestReader and responseWriter
+// explicitProviderMap returns only supported RequestReader and ResponseWriter
 // from explicited consumes and produces.
 type explicitProviderMap struct {
 	consumes []string
@@ -103,7 +168,7 @@ func newExplicitProviderMap(parent *providerMap) *explicitProviderMap {
 
 // GetRequestReaders returns only readers which support the given media type
 // and that media type must be in the consumes list if set.
-func (p *explicitProviderMap) GetRequestReaders(mime string) []requestReader {
+func (p *explicitProviderMap) GetRequestReaders(mime string) []RequestReader {
 	if len(p.consumes) == 0 {
 		return p.parent.GetRequestReaders(mime)
 	}
@@ -127,7 +192,7 @@ func (p *explicitProviderMap) GetRequestReaders(mime string) []requestReader {
 
 // GetResponseWriters returns only writers which support the given media type
 // and that media type must be in the produces list if set.
-func (p *explicitProviderMap) GetResponseWriters(mime string) []responseWriter {
+func (p *explicitProviderMap) GetResponseWriters(mime string) []ResponseWriter {
 	if len(p.produces) == 0 {
 		return p.parent.GetResponseWriters(mime)
 	}
@@ -149,6 +214,47 @@ func (p *explicitProviderMap) GetResponseWriters(mime string) []responseWriter {
 	return nil
 }
 
+// Consumes returns explicit consumes or all media types supported by readers.
+func (p *explicitProviderMap) Consumes() []string {
+	if len(p.consumes) > 0 {
+		return p.consumes
+	}
+	var mediaTypes []string
+	for _, r := range p.parent.readers {
+		mediaTypes = appendMediaTypes(mediaTypes, r.Consumes())
+	}
+	return mediaTypes
+}
+
+// Produces returns explicit produces or all media types supported by writers.
+func (p *explicitProviderMap) Produces() []string {
+	if len(p.produces) > 0 {
+		return p.produces
+	}
+	var mediaTypes []string
+	for _, w := range p.parent.writers {
+		mediaTypes = appendMediaTypes(mediaTypes, w.Produces())
+	}
+	return mediaTypes
+}
+
+// appendMediaTypes appends media types which are not in list.
+func appendMediaTypes(list []string, mediaTypes []string) []string {
+	for _, m := range mediaTypes {
+		found := false
+		for _, v := range list {
+			if v == m {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
 func isWildcard(mediaType string) bool {
 	return mediaType == "" || mediaType == "*/*"
 }
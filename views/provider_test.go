@@ -1,6 +1,13 @@
 package views
 
-import "testing"
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/goburrow/melon/server/router"
+)
 
 func TestDefaultProviders(t *testing.T) {
 	p := newProviderMap()
@@ -72,3 +79,60 @@ func TestExplicitProviders(t *testing.T) {
 		t.Fatalf("provider does not support text/xml %#v", p)
 	}
 }
+
+// userJSONProvider overrides the default JSON provider.
+type userJSONProvider struct {
+	Provider
+}
+
+func (p *userJSONProvider) Priority() int {
+	return PriorityUser
+}
+
+// textWriter only writes text/plain responses.
+type textWriter struct{}
+
+func (textWriter) Produces() []string {
+	return []string{"text/plain"}
+}
+
+func (textWriter) IsWriteable(http.ResponseWriter, *http.Request, interface{}) bool {
+	return true
+}
+
+func (textWriter) WriteResponse(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	_, err := fmt.Fprint(w, v)
+	return err
+}
+
+func TestProviderPriority(t *testing.T) {
+	p := newProviderMap()
+	jsonProvider := NewJSONProvider()
+	userProvider := &userJSONProvider{NewJSONProvider()}
+	p.AddProvider(jsonProvider)
+	p.AddProvider(NewXMLProvider())
+	p.AddProvider(userProvider)
+
+	readers := p.GetRequestReaders("application/json")
+	if len(readers) != 2 || readers[0] != userProvider || readers[1] != jsonProvider {
+		t.Fatalf("unexpected readers: %#v", readers)
+	}
+	writers := p.GetResponseWriters("*/*")
+	if len(writers) != 3 || writers[0] != userProvider || writers[1] != jsonProvider {
+		t.Fatalf("unexpected writers: %#v", writers)
+	}
+}
+
+func TestResponseWriterOnly(t *testing.T) {
+	rt := router.New()
+	h := newResourceHandler(rt, nil)
+	h.HandleResource(textWriter{})
+	h.HandleResource(NewResource("GET", "/", HandlerFunc(func(r *http.Request) (interface{}, error) {
+		return "text", nil
+	})))
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/plain" || w.Body.String() != "text" {
+		t.Fatalf("unexpected response: %v %v %s", w.Code, w.Header(), w.Body.String())
+	}
+}
@@ -3,12 +3,16 @@ package views
 
 import (
 	"context"
+	"fmt"
+	"mime/multipart"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/codahale/metrics"
 	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/body"
+	"github.com/goburrow/melon/server/recovery"
+	"github.com/goburrow/melon/server/timeout"
 )
 
 // Resource is a view resource.
@@ -29,11 +33,39 @@ func NewResource(method, path string, handler http.Handler, options ...Option) *
 	}
 }
 
+// Group is a set of resources sharing path prefix, filters and options.
+type Group struct {
+	prefix    string
+	options   []Option
+	filters   []http.Handler
+	resources []*Resource
+}
+
+// NewGroup creates a new Group which has the given path prefix and options
+// applied to all its resources. Options of each resource are applied after
+// the group options.
+func NewGroup(prefix string, options ...Option) *Group {
+	return &Group{
+		prefix:  prefix,
+		options: options,
+	}
+}
+
+// AddFilter adds filters which are only executed for resources in the group.
+func (g *Group) AddFilter(filters ...http.Handler) {
+	g.filters = append(g.filters, filters...)
+}
+
+// Add adds resources to the group.
+func (g *Group) Add(resources ...*Resource) {
+	g.resources = append(g.resources, resources...)
+}
+
 // Option add options to HTTP handlers.
 type Option func(h *httpHandler)
 
 // bundle adds support for resources in views package, which are
-// Resource, Provider and ErrorMapper.
+// Resource, Provider, RequestReader, ResponseWriter and ErrorMapper.
 type bundle struct {
 	providers []Provider
 }
@@ -49,16 +81,25 @@ func NewBundle(providers ...Provider) core.Bundle {
 func (u *bundle) Initialize(b *core.Bootstrap) {
 }
 
-// Run registers the view handler
+// Run registers the view handler to the application and all named
+// application contexts.
 func (u *bundle) Run(conf interface{}, env *core.Environment) error {
-	handler := newResourceHandler(env)
-	for _, p := range u.providers {
-		env.Server.Register(p)
+	u.register(env.Server, env)
+	for _, ctx := range env.Server.Contexts() {
+		u.register(ctx, env)
 	}
-	env.Server.AddResourceHandler(handler)
 	return nil
 }
 
+func (u *bundle) register(server *core.ServerEnvironment, env *core.Environment) {
+	handler := newResourceHandler(server.Router, env.Validator)
+	handler.errorMapper = newErrorMapper(env.Errors)
+	for _, p := range u.providers {
+		server.Register(p)
+	}
+	server.AddResourceHandler(handler)
+}
+
 // resourceHandler implements core.ResourceHandler
 type resourceHandler struct {
 	router    core.Router
@@ -69,40 +110,59 @@ type resourceHandler struct {
 	errorMapper ErrorMapper
 }
 
-func newResourceHandler(env *core.Environment) *resourceHandler {
+func newResourceHandler(router core.Router, validator core.Validator) *resourceHandler {
 	return &resourceHandler{
-		router:    env.Server.Router,
-		validator: env.Validator,
+		router:    router,
+		validator: validator,
 
 		providers:   newProviderMap(),
-		errorMapper: newErrorMapper(),
+		errorMapper: newErrorMapper(nil),
 	}
 }
 
 // HandleResource registers providers.
-// It supports Provider, ErrorMapper and Resource.
+// It supports RequestReader, ResponseWriter, Provider, ErrorMapper, Resource
+// and Group.
 func (h *resourceHandler) HandleResource(v interface{}) {
-	if r, ok := v.(Provider); ok {
-		h.providers.AddProvider(r)
+	if r, ok := v.(RequestReader); ok {
+		h.providers.AddRequestReader(r)
+	}
+	if w, ok := v.(ResponseWriter); ok {
+		h.providers.AddResponseWriter(w)
 	}
 	if r, ok := v.(ErrorMapper); ok {
 		// FIMXE: support multiple error mappers.
 		h.errorMapper = r
 	}
 	if r, ok := v.(*Resource); ok {
-		handler := &httpHandler{
-			handler:     r.handler,
-			errorMapper: h.errorMapper,
-			validator:   h.validator,
-			providers:   newExplicitProviderMap(h.providers),
-		}
-		for _, opt := range r.options {
-			opt(handler)
+		h.handle(h.router, r, nil)
+	}
+	if g, ok := v.(*Group); ok {
+		router := h.router.Group(g.prefix, g.filters...)
+		for _, r := range g.resources {
+			h.handle(router, r, g.options)
 		}
-		h.router.Handle(r.method, r.path, handler)
 	}
 }
 
+// handle registers resource r to router with additional options applied
+// before options of the resource.
+func (h *resourceHandler) handle(router core.Router, r *Resource, options []Option) {
+	handler := &httpHandler{
+		handler:     r.handler,
+		errorMapper: h.errorMapper,
+		validator:   h.validator,
+		providers:   newExplicitProviderMap(h.providers),
+	}
+	for _, opt := range options {
+		opt(handler)
+	}
+	for _, opt := range r.options {
+		opt(handler)
+	}
+	router.Handle(r.method, r.path, handler)
+}
+
 // WithConsumes defines the MIME Types that a resource can accept.
 func WithConsumes(consumes ...string) Option {
 	return func(h *httpHandler) {
@@ -117,6 +177,39 @@ func WithProduces(produces ...string) Option {
 	}
 }
 
+// WithName sets name of the resource, which is reported in its endpoint.
+func WithName(name string) Option {
+	return func(h *httpHandler) {
+		h.name = name
+	}
+}
+
+// WithTags adds tags to the resource endpoint.
+func WithTags(tags ...string) Option {
+	return func(h *httpHandler) {
+		h.tags = append(h.tags, tags...)
+	}
+}
+
+// WithTimeout overrides the server request timeout for the resource.
+// If the server has no timeout filter, a deadline is added to the request
+// context only.
+func WithTimeout(d time.Duration) Option {
+	return func(h *httpHandler) {
+		h.timeout = d
+	}
+}
+
+// WithMaxBodySize limits request body of the resource to n bytes, replacing
+// the server limit. Requests exceeding the limit are responded with
+// 413 Request Entity Too Large. The server limit still applies to requests
+// with Content-Length (see body.SetLimit).
+func WithMaxBodySize(n int64) Option {
+	return func(h *httpHandler) {
+		h.maxBodySize = n
+	}
+}
+
 // WithTimerMetric adds metric record to the resource.
 func WithTimerMetric(name string) Option {
 	return func(h *httpHandler) {
@@ -129,9 +222,10 @@ const (
 )
 
 var (
-	errInternalServerError  = &ErrorMessage{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)}
-	errNotAcceptable        = &ErrorMessage{http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable)}
-	errUnsupportedMediaType = &ErrorMessage{http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType)}
+	errInternalServerError   = &ErrorMessage{http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)}
+	errNotAcceptable         = &ErrorMessage{http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable)}
+	errUnsupportedMediaType  = &ErrorMessage{http.StatusUnsupportedMediaType, http.StatusText(http.StatusUnsupportedMediaType)}
+	errRequestEntityTooLarge = &ErrorMessage{http.StatusRequestEntityTooLarge, http.StatusText(http.StatusRequestEntityTooLarge)}
 )
 
 // httpHandler implements melon server.webResource
@@ -146,6 +240,20 @@ type httpHandler struct {
 	metricLatency  *metrics.Histogram
 
 	htmlTemplate string
+
+	name        string
+	tags        []string
+	timeout     time.Duration
+	maxBodySize int64
+}
+
+// DescribeEndpoint reports type of the underlying handler and resource metadata.
+func (h *httpHandler) DescribeEndpoint(e *core.Endpoint) {
+	e.Handler = fmt.Sprintf("%T", h.handler)
+	e.Name = h.name
+	e.Tags = h.tags
+	e.Consumes = h.providers.Consumes()
+	e.Produces = h.providers.Produces()
 }
 
 // ServeHTTP attaches handlerContext to request context. It also checks
@@ -157,19 +265,32 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if h.metricLatency != nil {
 		defer h.recordLatency(time.Now())
 	}
+	if h.timeout > 0 && !timeout.Override(r, h.timeout) {
+		ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
 
 	requestReaders := h.getRequestReaders(r)
-	responseWriters, contentType := h.getResponseWriters(r)
+	produces := h.providers.Produces()
+	responseWriters, contentTypes := h.getResponseWriters(r, produces)
 	handlerCtx := &handlerContext{
-		handler:     h,
-		readers:     requestReaders,
-		writers:     responseWriters,
-		contentType: contentType,
+		handler:      h,
+		readers:      requestReaders,
+		writers:      responseWriters,
+		contentTypes: contentTypes,
 	}
+	defer handlerCtx.removeForms()
 	ctx := newContext(r.Context(), handlerCtx)
 	r = r.WithContext(ctx)
-	// Check if readable
-	if len(requestReaders) == 0 {
+	// Panics are written in the negotiated content type.
+	recovery.SetErrorMapper(r, h.errorMapper)
+	if len(produces) > 1 {
+		// Response content type depends on Accept header.
+		w.Header().Add("Vary", "Accept")
+	}
+	// Check if readable when the request has a body
+	if len(requestReaders) == 0 && r.Body != nil && r.Body != http.NoBody {
 		h.errorMapper.MapError(w, r, errUnsupportedMediaType)
 		return
 	}
@@ -178,35 +299,39 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.errorMapper.MapError(w, r, errNotAcceptable)
 		return
 	}
+	if h.maxBodySize > 0 && r.Body != nil && r.Body != http.NoBody {
+		if r.ContentLength > h.maxBodySize {
+			h.errorMapper.MapError(w, r, errRequestEntityTooLarge)
+			return
+		}
+		body.SetLimit(r, h.maxBodySize)
+	}
 	h.handler.ServeHTTP(w, r)
 }
 
-// getRequestReaders returns a list of requestReader according Content-Type in the request header.
-func (h *httpHandler) getRequestReaders(r *http.Request) []requestReader {
-	mime := r.Header.Get("Content-Type")
+// getRequestReaders returns a list of RequestReader according Content-Type in the request header.
+func (h *httpHandler) getRequestReaders(r *http.Request) []RequestReader {
+	mime := baseMediaType(r.Header.Get("Content-Type"))
 	return h.providers.GetRequestReaders(mime)
 }
 
-// getResponseWriters returns a list of responseWriter according Accept in the request header.
-func (h *httpHandler) getResponseWriters(r *http.Request) ([]responseWriter, string) {
-	mime := r.Header.Get("Accept")
-	if isWildcard(mime) {
-		return h.providers.GetResponseWriters(mime), ""
+// getResponseWriters returns a list of ResponseWriter according Accept in the
+// request header and produces, ordered by preference, and their respective
+// content types. Content types are nil when all media types are acceptable.
+func (h *httpHandler) getResponseWriters(r *http.Request, produces []string) ([]ResponseWriter, []string) {
+	accept := r.Header.Get("Accept")
+	if isWildcard(accept) {
+		return h.providers.GetResponseWriters(accept), nil
 	}
-	mediaTypes := strings.Split(mime, ",")
-	// Return providers that support the first mime type
-	for _, mime = range mediaTypes {
-		// TODO: support priority
-		idx := strings.Index(mime, ";")
-		if idx >= 0 {
-			mime = mime[:idx]
-		}
-		writers := h.providers.GetResponseWriters(mime)
-		if len(writers) > 0 {
-			return writers, mime
+	var writers []ResponseWriter
+	var contentTypes []string
+	for _, mime := range negotiate(accept, produces) {
+		for _, writer := range h.providers.GetResponseWriters(mime) {
+			writers = append(writers, writer)
+			contentTypes = append(contentTypes, mime)
 		}
 	}
-	return nil, ""
+	return writers, contentTypes
 }
 
 func (h *httpHandler) setMetrics(name string) {
@@ -228,11 +353,15 @@ func (h *httpHandler) recordLatency(start time.Time) {
 // TODO: May be it needs an allocation pool.
 type handlerContext struct {
 	handler *httpHandler
-	readers []requestReader
-	writers []responseWriter
-
-	// contentType is expected response content type
-	contentType string
+	readers []RequestReader
+	writers []ResponseWriter
+
+	// contentTypes are negotiated response content types of writers.
+	contentTypes []string
+	// forms are parsed multipart forms whose temporary files are removed
+	// after the request is handled. Server only removes files of the
+	// original request, not of requests derived from it.
+	forms []*multipart.Form
 }
 
 // contextKey is a value for use with context.WithValue
@@ -257,8 +386,26 @@ func fromContext(ctx context.Context) *handlerContext {
 	return nil
 }
 
+// addForm registers multipart form f to be removed after the request is
+// handled.
+func (c *handlerContext) addForm(f *multipart.Form) {
+	for _, form := range c.forms {
+		if form == f {
+			return
+		}
+	}
+	c.forms = append(c.forms, f)
+}
+
+// removeForms removes temporary files of all registered multipart forms.
+func (c *handlerContext) removeForms() {
+	for _, form := range c.forms {
+		form.RemoveAll()
+	}
+}
+
 // findReader finds first reader which can read request body to data.
-func (c *handlerContext) findReader(r *http.Request, v interface{}) requestReader {
+func (c *handlerContext) findReader(r *http.Request, v interface{}) RequestReader {
 	for _, reader := range c.readers {
 		if reader.IsReadable(r, v) {
 			return reader
@@ -268,22 +415,20 @@ func (c *handlerContext) findReader(r *http.Request, v interface{}) requestReade
 }
 
 // findWriter finds first writer which can write data and response content type.
-func (c *handlerContext) findWriter(w http.ResponseWriter, r *http.Request, data interface{}) (responseWriter, string) {
-	for _, writer := range c.writers {
+func (c *handlerContext) findWriter(w http.ResponseWriter, r *http.Request, data interface{}) (ResponseWriter, string) {
+	for i, writer := range c.writers {
 		if writer.IsWriteable(w, r, data) {
-			contentType := c.contentType
-			if isWildcard(contentType) {
-				contentTypes := writer.Produces()
-				if len(contentTypes) > 0 {
-					contentType = contentTypes[0]
-				} else {
-					contentType = ""
-				}
+			if c.contentTypes != nil {
+				return writer, c.contentTypes[i]
+			}
+			contentTypes := writer.Produces()
+			if len(contentTypes) > 0 {
+				return writer, contentTypes[0]
 			}
-			return writer, contentType
+			return writer, ""
 		}
 	}
-	return nil, c.contentType
+	return nil, ""
 }
 
 // Serve uses provider assigned to the request context to render data
@@ -338,6 +483,13 @@ func Entity(r *http.Request, v interface{}) error {
 	}
 	err := reader.ReadRequest(r, v)
 	if err != nil {
+		switch err.(type) {
+		case *ErrorMessage, *FieldErrorMessage:
+			return err
+		}
+		if body.IsTooLarge(r, err) {
+			return errRequestEntityTooLarge
+		}
 		return &ErrorMessage{statusUnprocessableEntity, err.Error()}
 	}
 	validator := ctx.handler.validator
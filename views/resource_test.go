@@ -0,0 +1,128 @@
+package views
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goburrow/melon/core"
+	"github.com/goburrow/melon/server/body"
+	"github.com/goburrow/melon/server/filter"
+	"github.com/goburrow/melon/server/router"
+)
+
+type headerFilter string
+
+func (s headerFilter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Filter", string(s))
+	filter.Continue(w, r)
+}
+
+func TestGroup(t *testing.T) {
+	rt := router.New()
+	h := newResourceHandler(rt, nil)
+	h.HandleResource(NewJSONProvider())
+	h.HandleResource(NewXMLProvider())
+
+	handler := func(r *http.Request) (interface{}, error) {
+		return "ok", nil
+	}
+	g := NewGroup("/v2", WithProduces("application/xml"))
+	g.AddFilter(headerFilter("v2"))
+	g.Add(NewResource("GET", "/xml", HandlerFunc(handler)),
+		NewResource("GET", "/json", HandlerFunc(handler), WithProduces("application/json")))
+	h.HandleResource(g)
+	h.HandleResource(NewResource("GET", "/json", HandlerFunc(handler)))
+
+	tests := []struct {
+		path        string
+		contentType string
+		filter      string
+	}{
+		{"/v2/xml", "application/xml", "v2"},
+		{"/v2/json", "application/json", "v2"},
+		{"/json", "application/json", ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest("GET", test.path, nil))
+		if 200 != w.Code {
+			t.Fatalf("unexpected status code for %s: %v", test.path, w.Code)
+		}
+		if test.contentType != w.Header().Get("Content-Type") || test.filter != w.Header().Get("X-Filter") {
+			t.Fatalf("unexpected headers for %s: %v", test.path, w.Header())
+		}
+	}
+}
+
+func TestResourceEndpoint(t *testing.T) {
+	rt := router.New()
+	h := newResourceHandler(rt, nil)
+	h.HandleResource(NewJSONProvider())
+	h.HandleResource(NewXMLProvider())
+
+	handler := func(r *http.Request) (interface{}, error) {
+		return "ok", nil
+	}
+	h.HandleResource(NewResource("POST", "/users", HandlerFunc(handler),
+		WithName("CreateUser"), WithTags("user"), WithConsumes("application/json")))
+
+	expected := core.Endpoint{
+		Method:   "POST",
+		Path:     "/users",
+		Handler:  "views.HandlerFunc",
+		Name:     "CreateUser",
+		Tags:     []string{"user"},
+		Consumes: []string{"application/json"},
+		Produces: []string{"application/json", "text/json", "text/javascript", "application/xml", "text/xml"},
+	}
+	endpoints := rt.Endpoints()
+	if !reflect.DeepEqual(expected, endpoints[0]) {
+		t.Fatalf("unexpected endpoint: %#v", endpoints[0])
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	rt := router.New()
+	rt.AddFilter(body.NewLimitFilter(5))
+	h := newResourceHandler(rt, nil)
+	h.HandleResource(NewJSONProvider())
+
+	handler := func(r *http.Request) (interface{}, error) {
+		var v string
+		if err := Entity(r, &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	h.HandleResource(NewResource("POST", "/small", HandlerFunc(handler)))
+	h.HandleResource(NewResource("POST", "/large", HandlerFunc(handler), WithMaxBodySize(10)))
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{"/small", `"abc"`, http.StatusOK},
+		{"/small", `"abcd"`, http.StatusRequestEntityTooLarge},
+		{"/large", `"abcdefgh"`, http.StatusOK},
+		{"/large", `"abcdefghi"`, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", test.path, strings.NewReader(test.body))
+		// Unknown length
+		r.ContentLength = -1
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, r)
+		if test.status != w.Code {
+			t.Fatalf("unexpected status code for %s %s: %v", test.path, test.body, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest("POST", "/large", strings.NewReader(`"abcdefghi"`)))
+	if http.StatusRequestEntityTooLarge != w.Code {
+		t.Fatalf("unexpected status code: %v", w.Code)
+	}
+}